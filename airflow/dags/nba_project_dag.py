@@ -2,15 +2,17 @@ from airflow import DAG
 from airflow.operators.bash import BashOperator
 from datetime import datetime, timedelta
 
-# TODO: Populate these 
-# Path to python installation .../bin/python3
-PYTHON_PATH = ''
+# TODO: Populate this 
 # Absolute path to the root directory of the project .../nba-live-scoring-analysis
 PROJECT_HOME = ''
 
-PYTHON_SCRIPTS_HOME = f'{PROJECT_HOME}/python'
 CONFIG_FILE_PATH = 'go/go_config.yaml'
 
+# Exit code of a lenient go task where some games failed. The task is marked skipped instead of
+# retried, and downstream tasks still run for the games that succeeded
+PARTIAL_SUCCESS_EXIT_CODE = 3
+
+# The go tasks take the game date explicitly. Games are processed two days after they are played
 GO_PARAMS = {
     'home': PROJECT_HOME, 
     'config': CONFIG_FILE_PATH 
@@ -32,38 +34,43 @@ with DAG(
     
     fetch_games_task = BashOperator(
         task_id='fetch_games_task',
-        bash_command='cd {{ params.python_dir}} && {{ params.python_path }} raw_game_data_sourcing.py {{ ds }}',
-        params={ 
-            'python_dir': PYTHON_SCRIPTS_HOME,
-            'python_path': PYTHON_PATH 
-        }
+        bash_command='cd {{ params.home }} && bin/nba_main games fetch --lenient --date={{ macros.ds_add(ds, -2) }} --config={{ params.config }}',
+        env={ 'PATH': '/usr/local/go/bin'},
+        skip_on_exit_code=PARTIAL_SUCCESS_EXIT_CODE,
+        params=GO_PARAMS
     )
     
     fetch_odds_task = BashOperator(
         task_id='fetch_raw_odds',
-        bash_command='cd {{ params.home }} && bin/nba_main --process=fetch_raw_odds --date={{ ds }} --config={{ params.config }}',
+        bash_command='cd {{ params.home }} && bin/nba_main odds fetch --date={{ macros.ds_add(ds, -2) }} --config={{ params.config }}',
         env={ 'PATH': '/usr/local/go/bin'},
         params=GO_PARAMS
     )
 
     clean_games_task = BashOperator(
         task_id='clean_games',
-        bash_command='cd {{ params.home }} && bin/nba_main --process=clean_games --date={{ ds }} --config={{ params.config }}',
+        bash_command='cd {{ params.home }} && bin/nba_main games clean --lenient --date={{ macros.ds_add(ds, -2) }} --config={{ params.config }}',
         env={ 'PATH': '/usr/local/go/bin'},
+        skip_on_exit_code=PARTIAL_SUCCESS_EXIT_CODE,
+        trigger_rule='none_failed',
         params=GO_PARAMS
     )
 
     clean_odds_task = BashOperator(
         task_id='clean_odds_task',
-        bash_command='cd {{ params.home }} && bin/nba_main --process=clean_raw_odds --date={{ ds }} --config={{ params.config }}',
+        bash_command='cd {{ params.home }} && bin/nba_main odds clean --lenient --date={{ macros.ds_add(ds, -2) }} --config={{ params.config }}',
         env={ 'PATH': '/usr/local/go/bin'},
+        skip_on_exit_code=PARTIAL_SUCCESS_EXIT_CODE,
+        trigger_rule='none_failed',
         params=GO_PARAMS
     )
     
     combine_games_and_odds_task = BashOperator(
         task_id='combine_games_and_odds_task',
-        bash_command='cd {{ params.home }} && bin/nba_main --process=combine_game_and_odds --date={{ ds }} --config={{ params.config }}',
+        bash_command='cd {{ params.home }} && bin/nba_main export csv --lenient --date={{ macros.ds_add(ds, -2) }} --config={{ params.config }}',
         env={ 'PATH': '/usr/local/go/bin'},
+        skip_on_exit_code=PARTIAL_SUCCESS_EXIT_CODE,
+        trigger_rule='none_failed',
         params=GO_PARAMS
     )
     
@@ -3,6 +3,7 @@ module nba
 go 1.23.0
 
 require (
+	github.com/mattn/go-sqlite3 v1.14.24
 	go.mongodb.org/mongo-driver v1.11.4
 	gopkg.in/yaml.v3 v3.0.1
 )
@@ -8,54 +8,53 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func CleanGames(date string) (err error) {
-	client, err := loadMongoDbClient(*Config)
+func CleanGames(ctx context.Context, store Store, date string) (err error) {
+	teamAbbrevIdMap, err := buildTeamIdMap(ctx, store)
 	if err != nil {
 		return err
 	}
-	defer func() {
-		if err4 := closeMongoDBConnection(client, err); err4 != nil {
-			err = err4
-		}
-	}()
-
-	teamAbbrevIdMap, err := buildTeamIdMap(getTeamMetadataCollection(client, Config.Database.Schema))
+	granularities, err := configuredGranularities(Config.Sampling.Granularities)
 	if err != nil {
 		return err
 	}
 
-	rawGamesCollection := getRawGamesCollection(client, Config.Database.Schema)
-	rawGames, err := findRawGames(date, rawGamesCollection)
+	rawGames, err := findRawGames(ctx, date, store)
 	if err != nil {
 		return err
 	}
+	stageReportFrom(ctx).recordGamesFound(len(rawGames))
 
-	var cleanedGames = make([]CleanedGame, 0, len(rawGames))
-	for _, rawGame := range rawGames {
-		cleanedGame, err := cleanGame(rawGame, teamAbbrevIdMap)
+	cleanedGames, failures, err := processGames(ctx, CleanAllGames, date, rawGames, rawGameId, func(ctx context.Context, rawGame RawNbaGame) (CleanedGame, error) {
+		cleanedGame, err := cleanGame(rawGame, teamAbbrevIdMap, granularities)
 		if err != nil {
-			return err
+			return CleanedGame{}, err
 		}
-		cleanedGames = append(cleanedGames, *cleanedGame)
+		return *cleanedGame, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = store.UpsertCleanedGames(ctx, cleanedGames); err != nil {
+		return err
 	}
-	return upsertItems(cleanedGames, getCleanedGamesCollection(client, Config.Database.Schema))
+	stageReportFrom(ctx).recordGamesCleaned(len(cleanedGames))
+	return recordProcessingErrors(ctx, store, CleanAllGames, failures, cleanedGameIds(cleanedGames))
 }
 
-func findRawGames(date string, dbCollection *mongo.Collection) (rawGames []RawNbaGame, err error) {
-	cursor, err1 := dbCollection.Find(context.TODO(), dateFieldStringFilter(date))
-	err2 := cursor.All(context.TODO(), &rawGames)
-	if err1 != nil || err2 != nil {
-		return nil, errors.New("error fetching from raw games DB")
+func findRawGames(ctx context.Context, date string, store Store) (rawGames []RawNbaGame, err error) {
+	rawGames, err = store.FindRawGames(ctx, date)
+	if err != nil {
+		return nil, err
 	}
-	Logger.Printf("Found %d games in DB", len(rawGames))
+	loggerFrom(ctx).Info("Found games in DB", "count", len(rawGames))
 	return rawGames, nil
 }
 
-func buildTeamIdMap(dbCollection *mongo.Collection) (map[string]string, error) {
-	teamMetadata, err := findTeamMetadata(dbCollection)
+func buildTeamIdMap(ctx context.Context, store Store) (map[string]string, error) {
+	teamMetadata, err := store.FindTeamMetadata(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -66,45 +65,44 @@ func buildTeamIdMap(dbCollection *mongo.Collection) (map[string]string, error) {
 	return teamIdMap, nil
 }
 
-func cleanGame(game RawNbaGame, teamIds map[string]string) (cleanedGame *CleanedGame, err error) {
+func cleanGame(game RawNbaGame, teamIds map[string]string, granularities []samplingGranularity) (cleanedGame *CleanedGame, err error) {
 	awayTeam, homeTeam, err2 := extractTeamsFromMatchup(game.Matchup, teamIds)
-	startTime, processedPlayByPlay, err1 := processPlayByPlay(game)
+	startTime, plays, periods, err1 := processPlayByPlay(game)
 	if err1 != nil || err2 != nil {
 		return nil, handleMultipleErrors(err1, err2)
 	}
 
-	return &CleanedGame{
-		GameId:     game.Parameters.GameId,
-		Date:       game.Date,
-		StartTime:  startTime,
-		AwayTeamId: awayTeam,
-		HomeTeamId: homeTeam,
-		PlayByPlay: processedPlayByPlay,
-		SeasonId:   game.SeasonId,
-	}, nil
+	defaultSampling, _ := parseGranularity(defaultGranularity)
+	cleanedGame = &CleanedGame{
+		GameId:          game.Parameters.GameId,
+		Date:            game.Date,
+		StartTime:       startTime,
+		AwayTeamId:      awayTeam,
+		HomeTeamId:      homeTeam,
+		PlayByPlay:      samplePlayByPlay(plays, defaultSampling),
+		SeasonId:        game.SeasonId,
+		Overtime:        periods > regulationPeriods,
+		OvertimePeriods: max(periods-regulationPeriods, 0),
+	}
+	for _, granularity := range granularities {
+		cleanedGame.Samplings = append(cleanedGame.Samplings, Sampling{
+			Granularity: granularity.name,
+			PlayByPlay:  samplePlayByPlay(plays, granularity),
+		})
+	}
+	return cleanedGame, nil
 }
 
-func upsertItems(cleanedGames []CleanedGame, dbCollection *mongo.Collection) error {
-	var operations []mongo.WriteModel
-	for _, doc := range cleanedGames {
-		operations = append(operations, mongo.NewUpdateOneModel().
-			SetFilter(gameIdFilter(doc.GameId)).
-			SetUpdate(bson.M{"$set": doc}).
-			SetUpsert(true))
-	}
-	_, err := upsertItemsGeneric(operations, dbCollection)
-	return err
-}
-
-func processPlayByPlay(game RawNbaGame) (startTime string, playByPlay []PlayByPlay, err error) {
-	var plays bson.A = game.PlayByPlayRows
+/* Returns the score after every play, for sampling at each granularity, and the number of periods played */
+func processPlayByPlay(game RawNbaGame) (startTime string, plays []scoredPlay, periods int32, err error) {
+	var rawPlays bson.A = game.PlayByPlayRows
 	var err1 error
-	prevTimeInterval, awayScore, homeScore := int32(-30), 0, 0
+	awayScore, homeScore := 0, 0
 
-	for i, element := range plays {
+	for i, element := range rawPlays {
 		rawPlay, err2 := extractRawPlayFields(element)
 		if err2 != nil {
-			return "", nil, err
+			return "", nil, 0, err2
 		}
 
 		if i == 0 {
@@ -117,19 +115,13 @@ func processPlayByPlay(game RawNbaGame) (startTime string, playByPlay []PlayByPl
 		}
 
 		if err1 != nil || err3 != nil {
-			return "", nil, handleMultipleErrors(err1, err3)
+			return "", nil, 0, handleMultipleErrors(err1, err3)
 		}
 
-		for prevTimeInterval+30 <= elapsed {
-			playByPlay = append(playByPlay, PlayByPlay{
-				SecondsElapsed: int32(prevTimeInterval + 30),
-				AwayScore:      awayScore,
-				HomeScore:      homeScore,
-			})
-			prevTimeInterval += 30
-		}
+		plays = append(plays, scoredPlay{secondsElapsed: elapsed, awayScore: awayScore, homeScore: homeScore})
+		periods = max(periods, rawPlay.Quarter)
 	}
-	return startTime, playByPlay, nil
+	return startTime, plays, periods, nil
 }
 
 func parseScoreString(rawScore string) (awayScore int, homeScore int, err error) {
@@ -143,8 +135,12 @@ func parseScoreString(rawScore string) (awayScore int, homeScore int, err error)
 	return awayScore, homeScore, nil
 }
 
-func timeElapsedFromGameClock(clockTime string, quarter int32) (secondsElapsed int32, err error) {
+/* The clock counts down the seconds remaining in the period, ex. 4:12 in the first overtime is 2,928 seconds elapsed */
+func timeElapsedFromGameClock(clockTime string, period int32) (secondsElapsed int32, err error) {
 	digits := strings.Split(clockTime, ":")
+	if len(digits) != 2 {
+		return 0, errors.New("error parsing game clock " + clockTime + ". Expected \"#:##\"")
+	}
 	mins, err1 := strconv.Atoi(digits[0])
 	seconds, err2 := strconv.Atoi(digits[1])
 
@@ -152,9 +148,31 @@ func timeElapsedFromGameClock(clockTime string, quarter int32) (secondsElapsed i
 		return 0, handleMultipleErrors(err1, err2)
 	}
 
-	elapsedInQuarter := int32(((11 - mins) * 60) + (60 - seconds))
-	prevQuarters := (quarter - 1) * (60 * 12)
-	return elapsedInQuarter + prevQuarters, nil
+	remaining := int32(mins*60 + seconds)
+	if period < 1 || remaining < 0 || remaining > periodSeconds(period) {
+		return 0, errors.New("error parsing game clock " + clockTime + ", not within period " + strconv.Itoa(int(period)))
+	}
+	return periodStartSeconds(period) + periodSeconds(period) - remaining, nil
+}
+
+func periodSeconds(period int32) int32 {
+	return ternaryOperator(period > regulationPeriods, overtimeSeconds, quarterSeconds)
+}
+
+func periodStartSeconds(period int32) int32 {
+	if period <= regulationPeriods {
+		return (period - 1) * quarterSeconds
+	}
+	return regulationPeriods*quarterSeconds + (period-regulationPeriods-1)*overtimeSeconds
+}
+
+/* The final second of a period belongs to it rather than the next, so the end of a quarter has 0 seconds remaining */
+func periodAtSecondsElapsed(secondsElapsed int32) (period int32, secondsRemaining int32) {
+	period = 1
+	for secondsElapsed > periodStartSeconds(period)+periodSeconds(period) {
+		period += 1
+	}
+	return period, periodStartSeconds(period) + periodSeconds(period) - secondsElapsed
 }
 
 func extractRawPlayFields(element interface{}) (*RawPlay, error) {
@@ -207,6 +225,14 @@ func extractTeamsFromMatchup(matchup string, teamIds map[string]string) (awayTea
 	return awayTeam, homeTeam, nil
 }
 
-func gameIdFilter(gameId string) bson.M {
-	return bson.M{"gameId": gameId}
+func rawGameId(game RawNbaGame) string {
+	return game.Parameters.GameId
+}
+
+func cleanedGameIds(games []CleanedGame) []string {
+	var gameIds = make([]string, 0, len(games))
+	for _, game := range games {
+		gameIds = append(gameIds, game.GameId)
+	}
+	return gameIds
 }
@@ -3,14 +3,10 @@ package helpers
 import (
 	"context"
 	"errors"
-	"fmt"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
-
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 var timezoneEstName string = "America/New_York"
@@ -22,45 +18,42 @@ var spreadKey string = "spreads"
 var totalKey string = "totals"
 var overOutcome string = "Over"
 
-func CleanOdds(date string) (err error) {
-	client, err := loadMongoDbClient(*Config)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		if err6 := closeMongoDBConnection(client, err); err6 != nil {
-			err = err6
-		}
-	}()
-
-	rawOddsCollection := getHistoricalOddscollection(client, Config.Database.Schema)
-	cleanedOddsCollection := getCleanedOddsCollection(client, Config.Database.Schema)
-	cleanedGamesCollection := getCleanedGamesCollection(client, Config.Database.Schema)
-	teamMetadataCollection := getTeamMetadataCollection(client, Config.Database.Schema)
-
-	teamIdsToNamesMap, err1 := fetchTeamNameToIds(teamMetadataCollection)
-	gamesOnDate, err2 := findCleanedGame(date, cleanedGamesCollection)
+func CleanOdds(ctx context.Context, store Store, date string) (err error) {
+	teamIdsToNamesMap, err1 := fetchTeamNameToIds(ctx, store)
+	gamesOnDate, err2 := findCleanedGame(ctx, date, store)
 	if err1 != nil || err2 != nil {
 		return handleMultipleErrors(err1, err2)
 	}
+	stageReportFrom(ctx).recordGamesFound(len(gamesOnDate))
 
-	var cleanedOdds = make([]CleanedOdds, 0, len(gamesOnDate))
-	for _, game := range gamesOnDate {
+	cleanedOdds, failures, err := processGames(ctx, CleanRawOdds, date, gamesOnDate, cleanedGameId, func(ctx context.Context, game CleanedGame) (CleanedOdds, error) {
 		utcHour, err3 := determineLatestHourBeforeGame(game)
-		rawOdds, err4 := findRawOdds(utcHour, game, teamIdsToNamesMap, rawOddsCollection)
-		cleanedOdd, err5 := cleanOddsEntry(rawOdds, game)
+		rawOdds, err4 := findRawOdds(ctx, utcHour, game, teamIdsToNamesMap, store)
+		cleanedOdd, err5 := cleanOddsEntry(ctx, rawOdds, game)
 
 		if err3 != nil || err4 != nil || err5 != nil {
-			return handleMultipleErrors(err3, err4, err5)
+			return CleanedOdds{}, handleMultipleErrors(err3, err4, err5)
 		}
-		cleanedOdds = append(cleanedOdds, *cleanedOdd)
+		return *cleanedOdd, nil
+	})
+	if err != nil {
+		return err
 	}
 
-	return upsertGameOdds(cleanedOdds, cleanedOddsCollection)
+	if err = store.UpsertCleanedOdds(ctx, cleanedOdds); err != nil {
+		return err
+	}
+	stageReportFrom(ctx).recordOddsMatched(cleanedOdds)
+
+	var succeededGameIds = make([]string, 0, len(cleanedOdds))
+	for _, odds := range cleanedOdds {
+		succeededGameIds = append(succeededGameIds, odds.GameId)
+	}
+	return recordProcessingErrors(ctx, store, CleanRawOdds, failures, succeededGameIds)
 }
 
-func fetchTeamNameToIds(dbCollection *mongo.Collection) (teamNameToIds map[string]string, err error) {
-	teamMetadata, err := findTeamMetadata(dbCollection)
+func fetchTeamNameToIds(ctx context.Context, store Store) (teamNameToIds map[string]string, err error) {
+	teamMetadata, err := store.FindTeamMetadata(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -73,7 +66,7 @@ func fetchTeamNameToIds(dbCollection *mongo.Collection) (teamNameToIds map[strin
 
 func determineLatestHourBeforeGame(game CleanedGame) (latestHour int, err error) {
 	gameStartTime, err1 := convertDateTimeToStandard(game.StartTime, game.Date, timezoneEstName)
-	for _, utcHour := range utcHoursForLookup {
+	for _, utcHour := range Config.Odds.SnapshotUtcHours {
 		clockTime := strconv.Itoa(utcHour) + amSuffix
 		utcStartTime, err2 := convertDateTimeToStandard(clockTime, game.Date, timezoneUtcName)
 
@@ -133,13 +126,12 @@ func convertDateTimeToStandard(clockTime string, date string, timezone string) (
 	return &standardTime, nil
 }
 
-func findRawOdds(utcHour int, game CleanedGame, teamIdsToNamesMap map[string]string, dbCollection *mongo.Collection) (oddsData OddsData, err error) {
+func findRawOdds(ctx context.Context, utcHour int, game CleanedGame, teamIdsToNamesMap map[string]string, store Store) (oddsData OddsData, err error) {
 	awayTeamName, ok1 := teamIdsToNamesMap[game.AwayTeamId]
 	homeTeamName, ok2 := teamIdsToNamesMap[game.HomeTeamId]
 
-	var rawOdds RawOddsResponse
-	err1 := dbCollection.FindOne(context.TODO(), rawOddsDbFilter(game.Date, utcHour)).Decode(&rawOdds)
-	if err1 != nil || !ok1 || !ok2 {
+	rawOdds, err1 := store.FindRawOdds(ctx, game.Date, utcHour)
+	if err1 != nil || rawOdds == nil || !ok1 || !ok2 {
 		return OddsData{}, errors.New("could not find any games for this date and time")
 	}
 
@@ -151,11 +143,11 @@ func findRawOdds(utcHour int, game CleanedGame, teamIdsToNamesMap map[string]str
 	return OddsData{}, errors.New("could not find odds for this game")
 }
 
-func cleanOddsEntry(odds OddsData, game CleanedGame) (cleanedOdds *CleanedOdds, err error) {
-	validBooks := filterAndOrderBookmakers(odds.Bookmakers, bookmakersPriority)
+func cleanOddsEntry(ctx context.Context, odds OddsData, game CleanedGame) (cleanedOdds *CleanedOdds, err error) {
+	validBooks := filterAndOrderBookmakers(odds.Bookmakers, bookmakerPriorities(Config.Odds.Bookmakers))
 	for _, bookmaker := range validBooks {
 		if len(bookmaker.Markets) == 3 {
-			ml, spread, total := extractOdds(bookmaker, odds.AwayTeam)
+			ml, spread, total := extractOdds(ctx, bookmaker, odds.AwayTeam)
 			return &CleanedOdds{
 				GameId:      game.GameId,
 				Bookmaker:   bookmaker.Key,
@@ -168,6 +160,15 @@ func cleanOddsEntry(odds OddsData, game CleanedGame) (cleanedOdds *CleanedOdds,
 	return nil, errors.New("could not find valid bookmaker")
 }
 
+/* Lower is preferred, in the order of the configured bookmakers */
+func bookmakerPriorities(bookmakers []string) map[string]int {
+	priorities := make(map[string]int, len(bookmakers))
+	for i, bookmaker := range bookmakers {
+		priorities[bookmaker] = i + 1
+	}
+	return priorities
+}
+
 func filterAndOrderBookmakers(allBooks []Bookmaker, bookmakersPriority map[string]int) []Bookmaker {
 	var validBooks = make([]Bookmaker, 0, len(bookmakersPriority))
 	for _, book := range allBooks {
@@ -181,7 +182,7 @@ func filterAndOrderBookmakers(allBooks []Bookmaker, bookmakersPriority map[strin
 	return validBooks
 }
 
-func extractOdds(bookmaker Bookmaker, awayTeam string) (ml MoneyLine, spread PointSpread, total Total) {
+func extractOdds(ctx context.Context, bookmaker Bookmaker, awayTeam string) (ml MoneyLine, spread PointSpread, total Total) {
 	for _, market := range bookmaker.Markets {
 		switch market.Key {
 		case moneylineKey:
@@ -191,7 +192,7 @@ func extractOdds(bookmaker Bookmaker, awayTeam string) (ml MoneyLine, spread Poi
 		case totalKey:
 			total = createTotal(market)
 		default:
-			fmt.Printf("Unknown market found: %s. Skipping", market.Key)
+			loggerFrom(ctx).Warn("Unknown market found. Skipping", "market", market.Key)
 		}
 	}
 	return ml, spread, total
@@ -233,18 +234,6 @@ func createTotal(market Market) (total Total) {
 	return total
 }
 
-func upsertGameOdds(odds []CleanedOdds, dbCollection *mongo.Collection) (err error) {
-	var operations = make([]mongo.WriteModel, 0, len(odds))
-	for _, game := range odds {
-		operations = append(operations, mongo.NewUpdateOneModel().
-			SetFilter(cleanedOddsGameFilter(game)).
-			SetUpdate(bson.M{"$set": game}).
-			SetUpsert(true))
-	}
-	_, err = upsertItemsGeneric(operations, dbCollection)
-	return err
-}
-
 func isValidClockTimeString(clocktime string) bool {
 	return len(clocktime) == 8 && clocktime[2] == ':' && (clocktime[5:] == " AM" || clocktime[5:] == " PM")
 }
@@ -253,6 +242,6 @@ func isValidDateString(date string) bool {
 	return len(date) == 10 && date[4] == '-' && date[7] == '-'
 }
 
-func cleanedOddsGameFilter(odds CleanedOdds) bson.M {
-	return bson.M{"game": odds.GameId}
+func cleanedGameId(game CleanedGame) string {
+	return game.GameId
 }
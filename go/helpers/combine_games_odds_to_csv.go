@@ -3,57 +3,84 @@ package helpers
 import (
 	"context"
 	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
 	"strconv"
-
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
+	"strings"
+	"time"
 )
 
-func CombineGamesAndOddsToCsv(date string) (err error) {
-	client, err0 := loadMongoDbClient(*Config)
-	if err0 != nil {
-		return err0
-	}
-	defer func() {
-		if err6 := closeMongoDBConnection(client, err); err6 != nil {
-			err = err6
-		}
-	}()
-
-	teamMetadataCollection := getTeamMetadataCollection(client, Config.Database.Schema)
-	cleanedGamesCollection := getCleanedGamesCollection(client, Config.Database.Schema)
-	cleanedOddsCollection := getCleanedOddsCollection(client, Config.Database.Schema)
+/* Rows of one game in the export */
+type gameExport struct {
+	gameRow   GameCsv
+	playsRows []PlayByPlayCsv
+}
 
-	teamIdToAbbrev, err3 := fetchTeamIdsToAbbreviation(teamMetadataCollection)
-	games, err1 := findCleanedGame(date, cleanedGamesCollection)
-	gameToOdds, err2 := findOddsForGames(games, cleanedOddsCollection)
+/* A game without cleaned odds fails the date, or in lenient mode is left out and recorded in processingErrors */
+func CombineGamesAndOddsToCsv(ctx context.Context, store Store, date string) (err error) {
+	teamIdToAbbrev, err3 := fetchTeamIdsToAbbreviation(ctx, store)
+	games, err1 := findCleanedGame(ctx, date, store)
+	gameToOdds, err2 := findOddsForGames(ctx, games, store)
 	if err1 != nil || err2 != nil || err3 != nil {
-		return handleMultipleErrors(err1, err2)
+		return handleMultipleErrors(err1, err2, err3)
+	}
+	stageReportFrom(ctx).recordGamesFound(len(games))
+
+	exports, failures, err := processGames(ctx, CombineGameWithOdds, date, games, cleanedGameId, func(ctx context.Context, game CleanedGame) (gameExport, error) {
+		odds, ok := gameToOdds[game.GameId]
+		if !ok {
+			return gameExport{}, errors.New("found no cleaned odds for the game, run odds clean first")
+		}
+		plays, err := game.sampledPlayByPlay(Config.Sampling.CsvGranularity)
+		if err != nil {
+			return gameExport{}, err
+		}
+		gameRow, err := createGameCsv(game, odds, teamIdToAbbrev)
+		if err != nil {
+			return gameExport{}, err
+		}
+		return gameExport{gameRow: gameRow, playsRows: createPlaysCsv(game.GameId, plays, odds)}, nil
+	})
+	if err != nil {
+		return err
 	}
 
+	var exportedGameIds = make([]string, 0, len(exports))
 	gameCsvRows := make(map[string][]string)
 	playsCsvRows := make(map[string][]string)
-	for _, game := range games {
-		gameRow := createGameCsv(game, gameToOdds[game.GameId], teamIdToAbbrev)
-		gameCsvRows[gameCsvKeyFunc(gameRow)] = gameRow
+	for _, export := range exports {
+		exportedGameIds = append(exportedGameIds, export.gameRow.GameId)
+		record := marshalCsvRow(export.gameRow)
+		gameCsvRows[gameCsvKeyFunc(record)] = record
 
-		playsRow := createPlaysCsv(game, gameToOdds[game.GameId])
-		for _, row := range playsRow {
-			playsCsvRows[playsCsvKeyFunc(row)] = row
+		for _, playRow := range export.playsRows {
+			record = marshalCsvRow(playRow)
+			playsCsvRows[playsCsvKeyFunc(record)] = record
 		}
 	}
 
-	err4 := upsertCsv(gamesCsvName, gameCsvRows, gameCsvKeyFunc)
-	err5 := upsertCsv(playsCsvName, playsCsvRows, playsCsvKeyFunc)
+	if err = splitLegacyCsvsOnFirstExport(ctx); err != nil {
+		return err
+	}
+	gameRecords, err4 := upsertCsv(ctx, gamesCsv, date, gameCsvRows)
+	playsRecords, err5 := upsertCsv(ctx, playsCsv, date, playsCsvRows)
 	if err4 != nil || err5 != nil {
 		return handleMultipleErrors(err4, err5)
 	}
-	return nil
+	if err = writeParquetFiles(ctx, date, gameRecords, playsRecords); err != nil {
+		return err
+	}
+	return recordProcessingErrors(ctx, store, CombineGameWithOdds, failures, exportedGameIds)
 }
 
-func fetchTeamIdsToAbbreviation(dbCollection *mongo.Collection) (teamsToAbbrev map[string]string, err error) {
-	teamMetaData, err := findTeamMetadata(dbCollection)
+func fetchTeamIdsToAbbreviation(ctx context.Context, store Store) (teamsToAbbrev map[string]string, err error) {
+	teamMetaData, err := store.FindTeamMetadata(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -64,12 +91,10 @@ func fetchTeamIdsToAbbreviation(dbCollection *mongo.Collection) (teamsToAbbrev m
 	return teamsToAbbrev, nil
 }
 
-func findOddsForGames(games []CleanedGame, dbCollection *mongo.Collection) (oddsByGame map[string]CleanedOdds, err error) {
-	var odds []CleanedOdds
-	cursor, err1 := dbCollection.Find(context.TODO(), cleanedGamesQueryFilter(games))
-	err2 := cursor.All(context.TODO(), &odds)
-	if err1 != nil || err2 != nil {
-		return nil, handleMultipleErrors(err1, err2)
+func findOddsForGames(ctx context.Context, games []CleanedGame, store Store) (oddsByGame map[string]CleanedOdds, err error) {
+	odds, err := store.FindCleanedOdds(ctx, cleanedGameIds(games))
+	if err != nil {
+		return nil, err
 	}
 
 	oddsByGame = make(map[string]CleanedOdds)
@@ -79,113 +104,444 @@ func findOddsForGames(games []CleanedGame, dbCollection *mongo.Collection) (odds
 	return oddsByGame, nil
 }
 
-func createGameCsv(game CleanedGame, odds CleanedOdds, teamIdToAbbrev map[string]string) []string {
-	awayScore, homeScore := extractFinalScore(game)
-	return []string{
-		game.GameId,
-		game.SeasonId,
-		game.Date,
-		game.StartTime,
-		teamIdToAbbrev[game.AwayTeamId],
-		game.AwayTeamId,
-		teamIdToAbbrev[game.HomeTeamId],
-		game.HomeTeamId,
-		strconv.FormatFloat(float64(odds.MoneyLine.AwayPrice), 'f', -2, 32),
-		strconv.FormatFloat(float64(odds.MoneyLine.HomePrice), 'f', -2, 32),
-		strconv.FormatFloat(float64(odds.PointSpread.AwaySpread), 'f', -1, 32),
-		strconv.FormatFloat(float64(odds.PointSpread.HomeSpread), 'f', -1, 32),
-		strconv.FormatFloat(float64(odds.Total.Total), 'f', -1, 32),
-		strconv.Itoa(awayScore),
-		strconv.Itoa(homeScore),
-	}
-}
-
-func extractFinalScore(game CleanedGame) (awayScore int, homeScore int) {
+func createGameCsv(game CleanedGame, odds CleanedOdds, teamIdToAbbrev map[string]string) (GameCsv, error) {
+	awayScore, homeScore, err := extractFinalScore(game)
+	if err != nil {
+		return GameCsv{}, err
+	}
+	awayTeamId, err1 := strconv.ParseInt(game.AwayTeamId, 10, 64)
+	homeTeamId, err2 := strconv.ParseInt(game.HomeTeamId, 10, 64)
+	if err1 != nil || err2 != nil {
+		return GameCsv{}, handleMultipleErrors(err1, err2)
+	}
+	return GameCsv{
+		GameId:               game.GameId,
+		SeasonId:             game.SeasonId,
+		Date:                 game.Date,
+		StartTime:            game.StartTime,
+		AwayTeamAbbreviation: teamIdToAbbrev[game.AwayTeamId],
+		AwayTeamId:           awayTeamId,
+		HomeTeamAbbreviation: teamIdToAbbrev[game.HomeTeamId],
+		HomeTeamId:           homeTeamId,
+		AwayMl:               odds.MoneyLine.AwayPrice,
+		HomeMl:               odds.MoneyLine.HomePrice,
+		AwaySpread:           odds.PointSpread.AwaySpread,
+		HomeSpread:           odds.PointSpread.HomeSpread,
+		PregameTotal:         odds.Total.Total,
+		AwayFinalScore:       awayScore,
+		HomeFinalScore:       homeScore,
+		Overtime:             ternaryOperator(game.Overtime, 1, 0),
+		OvertimePeriods:      game.OvertimePeriods,
+	}, nil
+}
+
+func extractFinalScore(game CleanedGame) (awayScore int, homeScore int, err error) {
+	if len(game.PlayByPlay) == 0 {
+		return 0, 0, errors.New("found no play by play in the cleaned game, run games clean again")
+	}
 	lastPlay := game.PlayByPlay[len(game.PlayByPlay)-1]
-	return lastPlay.AwayScore, lastPlay.HomeScore
+	return lastPlay.AwayScore, lastPlay.HomeScore, nil
 }
 
-func createPlaysCsv(game CleanedGame, odds CleanedOdds) (csvRows [][]string) {
+func createPlaysCsv(gameId string, plays []PlayByPlay, odds CleanedOdds) (playsRows []PlayByPlayCsv) {
 	awayIsFavored := odds.PointSpread.AwaySpread <= 0
-	for _, play := range game.PlayByPlay {
+	for _, play := range plays {
 		underdogScore := ternaryOperator(awayIsFavored, play.HomeScore, play.AwayScore)
 		favoriteScore := ternaryOperator(!awayIsFavored, play.HomeScore, play.AwayScore)
-		csvRows = append(csvRows, []string{
-			game.GameId,
-			strconv.Itoa(int(play.SecondsElapsed)),
-			strconv.Itoa(play.AwayScore),
-			strconv.Itoa(play.HomeScore),
-			strconv.Itoa(underdogScore),
-			strconv.Itoa(favoriteScore),
-			strconv.Itoa(favoriteScore - underdogScore),
+		playsRows = append(playsRows, PlayByPlayCsv{
+			GameId:           gameId,
+			SecondsElapsed:   play.SecondsElapsed,
+			Period:           play.Period,
+			SecondsRemaining: play.SecondsRemaining,
+			AwayScore:        play.AwayScore,
+			HomeScore:        play.HomeScore,
+			UnderdogScore:    underdogScore,
+			FavoriteScore:    favoriteScore,
+			FavoriteMargin:   favoriteScore - underdogScore,
 		})
 	}
-	return csvRows
+	return playsRows
+}
+
+/* A csv of the export: its row struct, the key a row is upserted by and the order rows are kept in */
+type csvSpec struct {
+	name         func() string
+	description  string
+	header       []string
+	rowType      reflect.Type
+	gameIdColumn int
+	key          func(row []string) string
+	less         func(a []string, b []string) bool
+}
+
+/* File names are read from the config when used, since the specs are built before the config is read */
+var gamesCsv = newCsvSpec[GameCsv](func() string { return Config.Csv.GamesFileName }, "One row per game, with the pregame odds and the final score", gameCsvKeyFunc, gameCsvLess)
+var playsCsv = newCsvSpec[PlayByPlayCsv](func() string { return granularityFileName(Config.Csv.PlaysFileName, Config.Sampling.CsvGranularity) },
+	"One row per game and sampled interval, 30 seconds unless exported at another granularity, with the score at that time", playsCsvKeyFunc, playsCsvLess)
+
+func newCsvSpec[T any](name func() string, description string, key func(row []string) string, less func(a []string, b []string) bool) csvSpec {
+	rowType := reflect.TypeFor[T]()
+	return csvSpec{name: name, description: description, header: csvHeader(rowType), rowType: rowType,
+		gameIdColumn: csvColumnIndex[T]("game_id"), key: key, less: less}
+}
+
+/* Both csvs have the game id, so a game's rows are found in either */
+func (spec csvSpec) gameId(row []string) string {
+	return row[spec.gameIdColumn]
 }
 
-func upsertCsv(csvName string, rowsToInsert map[string][]string, getKey func([]string) string) error {
+/* Rows are partitioned by the month of their game date, ex. csvs/games_summary_data/2024-10.csv */
+func (spec csvSpec) partitionPath(date string) string {
+	return filepath.Join(spec.partitionDirectory(), date[:len("2006-01")]+".csv")
+}
+
+func (spec csvSpec) partitionDirectory() string {
+	return filepath.Join(Config.Csv.Directory, strings.TrimSuffix(spec.name(), ".csv"))
+}
+
+/* The single file layout the analysis scripts read, built from the partitions by export concat */
+func (spec csvSpec) legacyPath() string {
+	return filepath.Join(Config.Csv.Directory, spec.name())
+}
+
+/*
+Only the month partition of the date is read and rewritten, so the cost of an export does not grow with
+history. Rows are sorted rather than appended, so reruns produce the same file and git diffs stay small.
+The rows of a game replace all of its earlier rows, so rows a game no longer has, ex. the intervals past
+the end of an overtime that was sampled wrong, are deleted rather than left behind.
+The file is replaced through a synced temp file, so a crash mid write leaves the previous csv in place.
+Returns the rows of the partition after the upsert
+*/
+func upsertCsv(ctx context.Context, spec csvSpec, date string, rowsToInsert map[string][]string) ([][]string, error) {
 	var numUpdatedRows int
 	var numNewRows int
+	var numDeletedRows int
 
-	fullCsvPath := csvDirectory + "/" + csvName
-	readFile, err1 := os.Open(fullCsvPath)
-	if err1 != nil {
-		return err1
+	path := spec.partitionPath(date)
+	rows, err := readCsvRows(spec, path)
+	if err != nil {
+		return nil, err
 	}
-	defer readFile.Close()
 
-	reader := csv.NewReader(readFile)
-	rows, err2 := reader.ReadAll()
-	if err2 != nil {
-		return err2
+	gameIds := make(map[string]bool)
+	for _, row := range rowsToInsert {
+		gameIds[spec.gameId(row)] = true
 	}
-
 	var newCsv [][]string
 	for _, row := range rows {
-		if val, exists := rowsToInsert[getKey(row)]; !exists {
-			newCsv = append(newCsv, row)
-		} else {
+		if val, exists := rowsToInsert[spec.key(row)]; exists {
 			newCsv = append(newCsv, val)
-			numUpdatedRows += 1
-			delete(rowsToInsert, getKey(row))
+			delete(rowsToInsert, spec.key(row))
+			if !DryRun || logCsvRowDiff(ctx, spec.name(), spec.key(row), spec.header, row, val) {
+				numUpdatedRows += 1
+			}
+		} else if gameIds[spec.gameId(row)] {
+			numDeletedRows += 1
+			if DryRun {
+				loggerFrom(ctx).Info("Dry run: would delete csv row", "csv", spec.name(), "key", spec.key(row))
+			}
+		} else {
+			newCsv = append(newCsv, row)
 		}
 	}
 	for _, row := range rowsToInsert {
 		newCsv = append(newCsv, row)
 		numNewRows += 1
+		if DryRun {
+			loggerFrom(ctx).Info("Dry run: would insert csv row", "csv", spec.name(), "key", spec.key(row))
+		}
 	}
 
-	writeFile, err3 := os.Create(fullCsvPath)
-	if err3 != nil {
-		return err3
+	if DryRun {
+		loggerFrom(ctx).Info("Dry run: planned csv changes", "csv", spec.name(), "path", path, "inserts", numNewRows, "updates", numUpdatedRows, "deletes", numDeletedRows)
+		stageReportFrom(ctx).recordCsvWrites(spec.name(), numNewRows, numUpdatedRows, numDeletedRows)
+		return newCsv, nil
 	}
 
-	writer := csv.NewWriter(writeFile)
-	defer writer.Flush()
-	for _, row := range newCsv {
-		if err4 := writer.Write(row); err4 != nil {
-			return err4
+	if err = writeCsvFile(path, spec, newCsv); err != nil {
+		return nil, err
+	}
+	loggerFrom(ctx).Info("Wrote csv", "csv", spec.name(), "path", path, "inserted", numNewRows, "updated", numUpdatedRows, "deleted", numDeletedRows)
+	stageReportFrom(ctx).recordCsvWrites(spec.name(), numNewRows, numUpdatedRows, numDeletedRows)
+	csvRows.add(float64(numNewRows), spec.name(), "inserted")
+	csvRows.add(float64(numUpdatedRows), spec.name(), "updated")
+	csvRows.add(float64(numDeletedRows), spec.name(), "deleted")
+	return newCsv, nil
+}
+
+/* Rows are sorted first. The file is replaced through a synced temp file, see writeFileAtomically */
+func writeCsvFile(path string, spec csvSpec, rows [][]string) error {
+	sort.SliceStable(rows, func(i, j int) bool {
+		return spec.less(rows[i], rows[j])
+	})
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomically(path, func(w io.Writer) error {
+		writer := csv.NewWriter(w)
+		if err := writer.Write(spec.header); err != nil {
+			return err
 		}
+		return writer.WriteAll(rows)
+	})
+}
+
+/* Returns the rows without the header. A missing csv has no rows yet, a csv with older columns is upgraded, see upgradeCsvRows */
+func readCsvRows(spec csvSpec, path string) ([][]string, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
 	}
-	Logger.Printf("For csv %s inserted %d new rows and updated %d rows", csvName, numNewRows, numUpdatedRows)
-	return nil
+	defer file.Close()
+
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	if !slices.Equal(rows[0], spec.header) {
+		return upgradeCsvRows(spec, path, rows[0], rows[1:])
+	}
+	return rows[1:], nil
 }
 
-func cleanedGamesQueryFilter(games []CleanedGame) bson.M {
-	var gameIds = make([]string, 0, len(games))
-	for _, game := range games {
-		gameIds = append(gameIds, game.GameId)
+/*
+Csvs written before a column was added are read with the columns in the current order, the added ones
+set to zero, ex. period 0 for plays exported before periods. The next write of the csv rewrites it with
+the current header. Columns the current header lacks are an error rather than dropped
+*/
+func upgradeCsvRows(spec csvSpec, path string, header []string, rows [][]string) ([][]string, error) {
+	columns := csvColumns(spec.rowType)
+	values := make([]string, len(columns))
+	indexes := make([]int, len(columns))
+	for i, column := range columns {
+		indexes[i] = slices.Index(header, column.name)
+		if column.kind != reflect.String {
+			values[i] = "0"
+		}
 	}
-	return bson.M{
-		"gameId": bson.M{
-			"$in": gameIds,
-		}}
+	for _, name := range header {
+		if !slices.Contains(spec.header, name) {
+			return nil, fmt.Errorf("csv %s has columns %s, expected %s", path,
+				strings.Join(header, ","), strings.Join(spec.header, ","))
+		}
+	}
+
+	upgradedRows := make([][]string, len(rows))
+	for i, row := range rows {
+		upgradedRows[i] = slices.Clone(values)
+		for j, index := range indexes {
+			if index >= 0 {
+				upgradedRows[i][j] = row[index]
+			}
+		}
+	}
+	return upgradedRows, nil
 }
 
+/* Rows are keyed, sorted and partitioned by these columns, looked up by name so reordering the struct fields is safe */
+var (
+	gameIdColumn         = csvColumnIndex[GameCsv]("game_id")
+	gameDateColumn       = csvColumnIndex[GameCsv]("game_date")
+	playGameIdColumn     = csvColumnIndex[PlayByPlayCsv]("game_id")
+	secondsElapsedColumn = csvColumnIndex[PlayByPlayCsv]("seconds_elapsed")
+	periodColumn         = csvColumnIndex[PlayByPlayCsv]("period")
+)
+
 func gameCsvKeyFunc(row []string) string {
-	return row[0]
+	return row[gameIdColumn]
 }
 
 func playsCsvKeyFunc(row []string) string {
-	return row[0] + row[1]
+	return row[playGameIdColumn] + row[secondsElapsedColumn]
+}
+
+/* Play rows exported before the period column read period 0, see upgradeCsvRows */
+func playsCsvRowBeforePeriods(row []string) bool {
+	return row[periodColumn] == "0"
+}
+
+/* By game date, then game id */
+func gameCsvLess(a []string, b []string) bool {
+	if a[gameDateColumn] != b[gameDateColumn] {
+		return a[gameDateColumn] < b[gameDateColumn]
+	}
+	return a[gameIdColumn] < b[gameIdColumn]
+}
+
+/*
+By game id, then seconds elapsed. Game ids are in schedule order within a season type only, so in April the
+play-in games, 005 ids, sort after the playoff games, 004 ids, though they are played first
+*/
+func playsCsvLess(a []string, b []string) bool {
+	if a[playGameIdColumn] != b[playGameIdColumn] {
+		return a[playGameIdColumn] < b[playGameIdColumn]
+	}
+	aSeconds, _ := strconv.Atoi(a[secondsElapsedColumn])
+	bSeconds, _ := strconv.Atoi(b[secondsElapsedColumn])
+	return aSeconds < bSeconds
+}
+
+/*
+Same rows as the csvs, typed, read from the month partitions as the export left them, so a game that failed
+keeps its earlier rows in both. Each run rewrites the date's files, and removes those of seasons the date no
+longer has games in
+*/
+func writeParquetFiles(ctx context.Context, date string, gameRecords [][]string, playsRecords [][]string) error {
+	gameRows, err1 := unmarshalCsvRows[GameCsv](gameRecords)
+	playsRows, err2 := unmarshalCsvRows[PlayByPlayCsv](playsRecords)
+	if err1 != nil || err2 != nil {
+		return handleMultipleErrors(err1, err2)
+	}
+
+	gamesTables := make(map[string]*parquetTable)
+	playsTables := make(map[string]*parquetTable)
+	gameSeasons := make(map[string]string)
+	for _, row := range gameRows {
+		if row.Date != date {
+			continue
+		}
+		season, err := seasonPartition(row)
+		if err != nil {
+			return err
+		}
+		if _, ok := gamesTables[season]; !ok {
+			gamesTables[season] = newCsvParquetTable(gamesCsv)
+			playsTables[season] = newCsvParquetTable(playsCsv)
+		}
+		gameSeasons[row.GameId] = season
+		if err = addCsvParquetRow(gamesTables[season], row); err != nil {
+			return err
+		}
+	}
+	for _, row := range playsRows {
+		if season, ok := gameSeasons[row.GameId]; ok {
+			if err := addCsvParquetRow(playsTables[season], row); err != nil {
+				return err
+			}
+		}
+	}
+
+	playsTableName := granularityFileName(playsParquetTable, Config.Sampling.CsvGranularity)
+	for season, table := range gamesTables {
+		err1 := writeParquetFile(ctx, gamesParquetTable, season, date, table)
+		err2 := writeParquetFile(ctx, playsTableName, season, date, playsTables[season])
+		if err1 != nil || err2 != nil {
+			return handleMultipleErrors(err1, err2)
+		}
+	}
+	err1 = removeStaleParquetFiles(ctx, gamesParquetTable, date, gamesTables)
+	err2 = removeStaleParquetFiles(ctx, playsTableName, date, gamesTables)
+	return handleMultipleErrors(err1, err2)
+}
+
+/* The columns are the csv's, typed by their fields. Go ints are stored as int32, and strings formatted as dates as dates */
+func newCsvParquetTable(spec csvSpec) *parquetTable {
+	var columns []*parquetColumn
+	for _, column := range csvColumns(spec.rowType) {
+		switch {
+		case column.kind == reflect.String && column.format == "date":
+			columns = append(columns, dateParquetColumn(column.name))
+		case column.kind == reflect.String:
+			columns = append(columns, stringParquetColumn(column.name))
+		case column.kind == reflect.Int || column.kind == reflect.Int32:
+			columns = append(columns, int32ParquetColumn(column.name))
+		case column.kind == reflect.Int64:
+			columns = append(columns, int64ParquetColumn(column.name))
+		case column.kind == reflect.Float32 || column.kind == reflect.Float64:
+			columns = append(columns, doubleParquetColumn(column.name))
+		default:
+			panic(fmt.Sprintf("csv column %s has unsupported type %s", column.name, column.kind))
+		}
+	}
+	return newParquetTable(columns...)
+}
+
+func addCsvParquetRow(table *parquetTable, row interface{}) error {
+	value := reflect.ValueOf(row)
+	var values []interface{}
+	for _, column := range csvColumns(value.Type()) {
+		field := value.Field(column.field)
+		switch {
+		case column.kind == reflect.String && column.format == "date":
+			date, err := time.Parse(dateLayout, field.String())
+			if err != nil {
+				return fmt.Errorf("error parsing csv column %s: %w", column.name, err)
+			}
+			values = append(values, date)
+		case column.kind == reflect.String:
+			values = append(values, field.String())
+		case column.kind == reflect.Int || column.kind == reflect.Int32:
+			values = append(values, int32(field.Int()))
+		case column.kind == reflect.Int64:
+			values = append(values, field.Int())
+		case column.kind == reflect.Float32:
+			values = append(values, parquetFloat(float32(field.Float())))
+		default:
+			values = append(values, field.Float())
+		}
+	}
+	return table.addRow(values...)
+}
+
+/* Widened through its shortest decimal form, so a price of 1.91 is stored as 1.91 rather than 1.9100000858 */
+func parquetFloat(value float32) float64 {
+	widened, _ := strconv.ParseFloat(strconv.FormatFloat(float64(value), 'f', -1, 32), 64)
+	return widened
+}
+
+/* Season ids are the season type digit followed by the starting year, ex. 22024 for the 2024-25 regular season */
+func seasonPartition(row GameCsv) (string, error) {
+	if len(row.SeasonId) != 5 {
+		return "", errors.New("unexpected season id " + row.SeasonId + " for game " + row.GameId)
+	}
+	return row.SeasonId[1:], nil
+}
+
+func parquetFilePath(tableName string, season string, date string) string {
+	return filepath.Join(Config.Csv.ParquetDirectory, tableName, "season="+season, date+".parquet")
+}
+
+func writeParquetFile(ctx context.Context, tableName string, season string, date string, table *parquetTable) error {
+	path := parquetFilePath(tableName, season, date)
+	if DryRun {
+		loggerFrom(ctx).Info("Dry run: would write parquet file", "path", path, "rows", table.numRows)
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := writeFileAtomically(path, table.writeTo); err != nil {
+		return err
+	}
+	loggerFrom(ctx).Info("Wrote parquet file", "path", path, "rows", table.numRows)
+	return nil
+}
+
+/* Files of the date in seasons it has no games in, ex. every file of a date the games csv has no rows of */
+func removeStaleParquetFiles(ctx context.Context, tableName string, date string, tables map[string]*parquetTable) error {
+	paths, err := filepath.Glob(parquetFilePath(tableName, "*", date))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		season := strings.TrimPrefix(filepath.Base(filepath.Dir(path)), "season=")
+		if _, ok := tables[season]; ok {
+			continue
+		}
+		if DryRun {
+			loggerFrom(ctx).Info("Dry run: would remove parquet file", "path", path)
+			continue
+		}
+		if err = os.Remove(path); err != nil {
+			return err
+		}
+		loggerFrom(ctx).Info("Removed parquet file", "path", path)
+	}
+	return nil
 }
@@ -0,0 +1,299 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const teamMetadataSeed = `[
+	{"teamId": 1610612747, "teamName": "Los Angeles Lakers", "teamAbbreviation": "LAL"},
+	{"teamId": 1610612750, "teamName": "Minnesota Timberwolves", "teamAbbreviation": "MIN"}
+]`
+
+/* Play by play rows as the stats API returns them, ending in an overtime period */
+const rawGamesSeed = `[{
+	"resource": "playbyplay",
+	"parameters": {"GameID": "0022400061", "StartPeriod": 1, "EndPeriod": 10},
+	"gameId": "0022400061",
+	"date": "2024-10-22",
+	"matchup": "LAL vs. MIN",
+	"seasonId": "22024",
+	"rawPlayByPlay": [
+		["0022400061", 2, 12, 0, 1, "7:30 PM", "12:00", null, null, null, null, null],
+		["0022400061", 4, 1, 1, 1, "7:31 PM", "11:41", "James Dunk", null, null, "0 - 2", "2"],
+		["0022400061", 7, 1, 1, 1, "7:32 PM", "11:00", null, null, "Edwards 3PT", "3 - 2", "-1"],
+		["0022400061", 612, 13, 0, 4, "9:40 PM", "0:00", null, null, null, "100 - 100", "TIE"],
+		["0022400061", 700, 13, 0, 5, "9:55 PM", "0:00", null, null, null, "103 - 110", "7"]
+	]
+}]`
+
+/* The 23:00 UTC snapshot is the latest before the 7:30 PM Eastern tip off. fanduel lacks totals, so draftkings is used */
+const rawOddsSeed = `[{
+	"timestamp": "2024-10-22T23:00:00Z",
+	"date": "2024-10-22",
+	"utcHour": 23,
+	"data": [{
+		"id": "a1b2c3",
+		"sport_key": "basketball_nba",
+		"commence_time": "2024-10-22T23:30:00Z",
+		"home_team": "Los Angeles Lakers",
+		"away_team": "Minnesota Timberwolves",
+		"bookmakers": [
+			{"key": "fanduel", "markets": [
+				{"key": "h2h", "outcomes": [{"name": "Minnesota Timberwolves", "price": 1.8}, {"name": "Los Angeles Lakers", "price": 2.05}]},
+				{"key": "spreads", "outcomes": [{"name": "Minnesota Timberwolves", "price": 1.91, "point": -2.0}, {"name": "Los Angeles Lakers", "price": 1.91, "point": 2.0}]}
+			]},
+			{"key": "draftkings", "markets": [
+				{"key": "h2h", "outcomes": [{"name": "Minnesota Timberwolves", "price": 1.83}, {"name": "Los Angeles Lakers", "price": 2.0}]},
+				{"key": "spreads", "outcomes": [{"name": "Minnesota Timberwolves", "price": 1.91, "point": -1.5}, {"name": "Los Angeles Lakers", "price": 1.91, "point": 1.5}]},
+				{"key": "totals", "outcomes": [{"name": "Over", "price": 1.91, "point": 224.5}, {"name": "Under", "price": 1.91, "point": 224.5}]}
+			]}
+		]
+	}]
+}]`
+
+/* A store of the backend seeded with the raw game and odds above, with the given processes run for their date */
+func seededStore(t *testing.T, backend string, processes ...ProcessFunc) Store {
+	t.Helper()
+	cfg := useTestConfig(t)
+	cfg.Database.SeedDirectory = t.TempDir()
+	for collection, seed := range map[string]string{
+		cfg.Collections.TeamMetadata: teamMetadataSeed,
+		cfg.Collections.RawGames:     rawGamesSeed,
+		cfg.Collections.RawOdds:      rawOddsSeed,
+	} {
+		if err := os.WriteFile(filepath.Join(cfg.Database.SeedDirectory, collection+".json"), []byte(seed), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store, err := newStore(*cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backend == sqliteBackend {
+		store = copyToSqliteStore(t, store.(*memoryStore), "2024-10-22")
+	}
+
+	for _, process := range processes {
+		if err = process(context.Background(), store, "2024-10-22"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+/* The memory store is seeded from json files, the sqlite store from its raw collections of the date */
+func copyToSqliteStore(t *testing.T, seeded *memoryStore, date string) Store {
+	t.Helper()
+	ctx := context.Background()
+	Config.Database.Backend = sqliteBackend
+	Config.Database.SqlitePath = filepath.Join(t.TempDir(), "nba.sqlite")
+	store, err := newSqliteStore(Config.Database.SqlitePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close(ctx) })
+
+	teams, err1 := seeded.FindTeamMetadata(ctx)
+	rawGames, err2 := seeded.FindRawGames(ctx, date)
+	rawOdds, err3 := seeded.FindRawOdds(ctx, date, 23)
+	if err1 != nil || err2 != nil || err3 != nil {
+		t.Fatal(handleMultipleErrors(err1, err2, err3))
+	}
+	err1 = store.upsertTeamMetadata(ctx, teams)
+	err2 = store.UpsertRawGames(ctx, rawGames)
+	err3 = store.UpsertRawOdds(ctx, []RawOddsResponse{*rawOdds})
+	if err1 != nil || err2 != nil || err3 != nil {
+		t.Fatal(handleMultipleErrors(err1, err2, err3))
+	}
+	return store
+}
+
+/* Runs the test against the memory store and against a sqlite store in a temp directory */
+func forEachStoreBackend(t *testing.T, test func(t *testing.T, backend string)) {
+	for _, backend := range []string{memoryBackend, sqliteBackend} {
+		t.Run(backend, func(t *testing.T) { test(t, backend) })
+	}
+}
+
+func TestCleanAndExportSeededGame(t *testing.T) {
+	forEachStoreBackend(t, func(t *testing.T, backend string) {
+		store := seededStore(t, backend, CleanGames, CleanOdds, CombineGamesAndOddsToCsv)
+		ctx := context.Background()
+
+		odds, err := store.FindCleanedOdds(ctx, []string{"0022400061"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(odds) != 1 || odds[0].Bookmaker != "draftkings" {
+			t.Errorf("expected the odds of draftkings, the first bookmaker with every market, got %+v", odds)
+		}
+
+		games, err := readCsvRows(gamesCsv, gamesCsv.partitionPath("2024-10-22"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantGames := [][]string{{"0022400061", "22024", "2024-10-22", "7:30 PM", "MIN", "1610612750", "LAL", "1610612747",
+			"1.83", "2", "-1.5", "1.5", "224.5", "103", "110", "1", "1"}}
+		if !reflect.DeepEqual(games, wantGames) {
+			t.Errorf("games csv: got %v, want %v", games, wantGames)
+		}
+
+		plays, err := readCsvRows(playsCsv, playsCsv.partitionPath("2024-10-22"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		/* Every 30 seconds through the end of the first overtime */
+		if len(plays) != 3180/30+1 {
+			t.Fatalf("plays csv: got %d rows, want %d", len(plays), 3180/30+1)
+		}
+		wantPlays := map[int][]string{
+			0:   {"0022400061", "0", "1", "720", "0", "0", "0", "0", "0"},
+			1:   {"0022400061", "30", "1", "690", "3", "2", "2", "3", "1"},
+			96:  {"0022400061", "2880", "4", "0", "100", "100", "100", "100", "0"},
+			97:  {"0022400061", "2910", "5", "270", "103", "110", "110", "103", "-7"},
+			106: {"0022400061", "3180", "5", "0", "103", "110", "110", "103", "-7"},
+		}
+		for i, want := range wantPlays {
+			if !reflect.DeepEqual(plays[i], want) {
+				t.Errorf("plays csv row %d: got %v, want %v", i, plays[i], want)
+			}
+		}
+	})
+}
+
+func TestReadCsvRowsUpgradesOlderColumns(t *testing.T) {
+	useTestConfig(t)
+	path := playsCsv.partitionPath("2024-10-22")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	olderCsv := "game_id,seconds_elapsed,away_score,home_score,underdog_score,favorite_score,favorite_margin\n0022400061,30,3,2,2,3,1\n"
+	if err := os.WriteFile(path, []byte(olderCsv), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := readCsvRows(playsCsv, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"0022400061", "30", "0", "0", "3", "2", "2", "3", "1"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("got %v, want %v", rows, want)
+	}
+
+	if err = os.WriteFile(path, []byte("game_id,seconds_elapsed,quarter\n0022400061,30,1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = readCsvRows(playsCsv, path); err == nil {
+		t.Error("expected an error for a column the current header lacks")
+	}
+}
+
+/* Play rows from before the period column, ex. overtime sampled past 3300 seconds, are replaced on the next export */
+func TestExportReplacesPlayRowsFromBeforePeriods(t *testing.T) {
+	forEachStoreBackend(t, func(t *testing.T, backend string) {
+		store := seededStore(t, backend, CleanGames, CleanOdds)
+		ctx := context.Background()
+		olderCsvs := map[string]string{
+			gamesCsv.partitionPath("2024-10-22"): "game_id,season_id,game_date,start_time,away_team_init,away_team_id,home_team_init,home_team_id,away_ml,home_ml,away_spread,home_spread,pregame_total,away_final_score,home_final_score\n" +
+				"0022400061,22024,2024-10-22,7:30 PM,MIN,1610612750,LAL,1610612747,1.83,2,-1.5,1.5,224.5,103,110\n",
+			playsCsv.partitionPath("2024-10-22"): "game_id,seconds_elapsed,away_score,home_score,underdog_score,favorite_score,favorite_margin\n" +
+				"0022400061,3300,103,110,110,103,-7\n0022400062,0,0,0,0,0,0\n",
+		}
+		for path, olderCsv := range olderCsvs {
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(olderCsv), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if exists, err := csvRowsExist(ctx, store, "2024-10-22"); err != nil || exists {
+			t.Fatalf("expected play rows without periods to need exporting again, got %v, %v", exists, err)
+		}
+		if err := CombineGamesAndOddsToCsv(ctx, store, "2024-10-22"); err != nil {
+			t.Fatal(err)
+		}
+		if exists, err := csvRowsExist(ctx, store, "2024-10-22"); err != nil || !exists {
+			t.Errorf("expected the export to be done, got %v, %v", exists, err)
+		}
+
+		plays, err := readCsvRows(playsCsv, playsCsv.partitionPath("2024-10-22"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(plays) != 3180/30+2 {
+			t.Fatalf("plays csv: got %d rows, want the %d rows of the game and the row of the other game", len(plays), 3180/30+1)
+		}
+		for _, row := range plays {
+			if row[0] == "0022400061" && row[1] == "3300" {
+				t.Errorf("expected the row past the end of the overtime to be deleted, got %v", row)
+			}
+		}
+		if want := []string{"0022400062", "0", "0", "0", "0", "0", "0", "0", "0"}; !reflect.DeepEqual(plays[len(plays)-1], want) {
+			t.Errorf("expected the rows of other games to be kept, got %v, want %v", plays[len(plays)-1], want)
+		}
+	})
+}
+
+func TestCleanedGamesWithoutPeriodsAreCleanedAgain(t *testing.T) {
+	forEachStoreBackend(t, func(t *testing.T, backend string) {
+		store := seededStore(t, backend, CleanGames)
+		ctx := context.Background()
+		if exists, err := cleanedGamesExist(ctx, store, "2024-10-22"); err != nil || !exists {
+			t.Fatalf("expected the cleaned game to be done, got %v, %v", exists, err)
+		}
+
+		games, err := store.FindCleanedGames(ctx, "2024-10-22")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range games[0].PlayByPlay {
+			games[0].PlayByPlay[i].Period = 0
+			games[0].PlayByPlay[i].SecondsRemaining = 0
+		}
+		if err = store.UpsertCleanedGames(ctx, games); err != nil {
+			t.Fatal(err)
+		}
+		if exists, err := cleanedGamesExist(ctx, store, "2024-10-22"); err != nil || exists {
+			t.Errorf("expected a game whose plays read period 0 to be cleaned again, got %v, %v", exists, err)
+		}
+	})
+}
+
+/* A game without play by play fails, and a panic in a worker goroutine, out of reach of the recover in RunForDates, fails its item */
+func TestExportFailsGamesWithoutPlayByPlay(t *testing.T) {
+	forEachStoreBackend(t, func(t *testing.T, backend string) {
+		store := seededStore(t, backend, CleanGames, CleanOdds)
+		ctx := context.Background()
+		games, err := store.FindCleanedGames(ctx, "2024-10-22")
+		if err != nil {
+			t.Fatal(err)
+		}
+		games[0].PlayByPlay = nil
+		if err = store.UpsertCleanedGames(ctx, games); err != nil {
+			t.Fatal(err)
+		}
+
+		Lenient = true
+		t.Cleanup(func() { Lenient = false })
+		if err = CombineGamesAndOddsToCsv(ctx, store, "2024-10-22"); !errors.Is(err, ErrPartialSuccess) {
+			t.Errorf("expected the game without play by play to be recorded as failed, got %v", err)
+		}
+
+		_, err = runWorkerPool(ctx, 2, []int{1, 2}, func(ctx context.Context, item int) (int, error) {
+			if item == 2 {
+				panic("unexpected item")
+			}
+			return item, nil
+		})
+		if err == nil || err.Error() != "panic: unexpected item" {
+			t.Errorf("expected the panic as an error, got %v", err)
+		}
+	})
+}
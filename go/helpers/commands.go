@@ -0,0 +1,242 @@
+package helpers
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+/* Subcommands of nba_main, each mapped onto a process type */
+type command struct {
+	name        string
+	process     ProcessType
+	description string
+}
+
+var commands = []command{
+	{"games fetch", FetchRawGames, "Fetch raw games with play by play from the NBA stats API"},
+	{"odds fetch", FetchRawOdds, "Fetch raw odds snapshots from the odds API"},
+	{"games clean", CleanAllGames, "Clean raw games into 30 second play by play intervals, and any other configured granularities"},
+	{"odds clean", CleanRawOdds, "Match raw odds snapshots to cleaned games"},
+	{"export csv", CombineGameWithOdds, "Combine cleaned games and odds into the csvs and the parquet files"},
+	{"export concat", ConcatCsvs, "Concatenate the monthly csv partitions into the single file csvs"},
+	{"export dictionary", WriteDataDictionary, "Write the JSON Schema and markdown data dictionary of the csv columns"},
+	{"pipeline run", RunPipeline, "Run every stage in dependency order, skipping stages already done"},
+	{"serve", Serve, "Run the pipeline stages nightly on a schedule, retrying failed stages"},
+	{"status", Status, "Print which stages completed for each date, from the pipelineRuns collection"},
+	{"db migrate", MigrateToSqlite, "Copy every MongoDB collection into the SQLite database set in the config file"},
+	{"config show", ShowConfig, "Print the effective config, after the environment overrides and secret files, with secrets redacted"},
+}
+
+/* Flag values shared by every subcommand. Process specific flags are nil when not registered */
+type commandArgs struct {
+	config      *string
+	date        *string
+	startDate   *string
+	endDate     *string
+	season      *string
+	lagDays     *int
+	dryRun      *bool
+	workers     *int
+	lenient     *bool
+	forceUnlock *bool
+	stages      *string
+	report      *string
+	schedule    *string
+	sampling    *string
+	granularity *string
+	/* Set when invoked with the deprecated --process flag instead of a subcommand */
+	legacy bool
+	/* Set when --lag-days was given rather than defaulted */
+	lagDaysSet bool
+}
+
+const (
+	exitCodeSuccess        = 0
+	exitCodeFailure        = 1
+	exitCodeUsage          = 2
+	exitCodePartialSuccess = 3
+)
+
+/* Exits directly on help and usage errors, since the logger is not set up yet */
+func parseCommand(args []string) (command, *commandArgs) {
+	if len(args) == 0 || isHelpArg(args[0]) || args[0] == "help" {
+		printUsage(os.Stdout)
+		os.Exit(exitCodeSuccess)
+	}
+
+	cmd, flagArgs, err := findCommand(args)
+	legacy := false
+	if err != nil && strings.HasPrefix(args[0], "-") {
+		cmd, flagArgs, err = findLegacyCommand(args)
+		legacy = err == nil
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		printUsage(os.Stderr)
+		os.Exit(exitCodeUsage)
+	}
+	if legacy {
+		fmt.Fprintf(os.Stderr, "Warning: --process is deprecated, run 'nba_main %s' instead. --date is read as the run date, as before\n", cmd.name)
+	}
+
+	flags, cmdArgs := newCommandFlagSet(cmd)
+	cmdArgs.legacy = legacy
+	if err = flags.Parse(flagArgs); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(exitCodeSuccess)
+		}
+		os.Exit(exitCodeUsage)
+	}
+	if flags.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "Error: unexpected arguments: %s\n\n", strings.Join(flags.Args(), " "))
+		flags.Usage()
+		os.Exit(exitCodeUsage)
+	}
+	flags.Visit(func(f *flag.Flag) {
+		cmdArgs.lagDaysSet = cmdArgs.lagDaysSet || f.Name == "lag-days"
+	})
+	return cmd, cmdArgs
+}
+
+func findCommand(args []string) (command, []string, error) {
+	for _, cmd := range commands {
+		words := strings.Fields(cmd.name)
+		if len(args) >= len(words) && strings.Join(args[:len(words)], " ") == cmd.name {
+			return cmd, args[len(words):], nil
+		}
+	}
+	return command{}, nil, errors.New("unknown command: " + strings.Join(leadingWords(args), " "))
+}
+
+/*
+Invocations from before the subcommands, ex. --process=clean_games --date=2024-10-24, still run with a
+deprecation warning. The process flag is removed and the remaining flags are parsed by the subcommand
+*/
+func findLegacyCommand(args []string) (command, []string, error) {
+	var processName string
+	var flagArgs []string
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		switch {
+		case !strings.HasPrefix(args[i], "-") || name != "process":
+			flagArgs = append(flagArgs, args[i])
+		case hasValue:
+			processName = value
+		case i+1 < len(args):
+			processName = args[i+1]
+			i++
+		}
+	}
+	if processName == "" {
+		return command{}, nil, errors.New("unknown command: " + strings.Join(leadingWords(args), " "))
+	}
+
+	cmd, err := findCommandByName(processName)
+	return cmd, flagArgs, err
+}
+
+/* Accepts a subcommand, ex. games clean, or the process name it runs, ex. clean_games */
+func findCommandByName(name string) (command, error) {
+	process, err := ValueOf(name)
+	for _, cmd := range commands {
+		if cmd.name == name || err == nil && cmd.process == process {
+			return cmd, nil
+		}
+	}
+	return command{}, errors.New("unknown command or process: " + name)
+}
+
+func newCommandFlagSet(cmd command) (*flag.FlagSet, *commandArgs) {
+	flags := flag.NewFlagSet("nba_main "+cmd.name, flag.ContinueOnError)
+	cmdArgs := &commandArgs{
+		config:  flags.String("config", "", "Specify the absolute path of the config file. Without one, the config comes from the defaults and NBA_ environment variables"),
+		lagDays: flags.Int("lag-days", defaultLagDays, "Specify how many days before today to run when no date is given"),
+		dryRun:  flags.Bool("dry-run", false, "Log the planned database writes and csv changes without applying them"),
+		workers: flags.Int("workers", Workers, "Specify how many games or odds snapshots to process concurrently"),
+		lenient: flags.Bool("lenient", false, "Record failing games in processingErrors and still write the games that succeeded"),
+	}
+	if cmd.writesReport() {
+		cmdArgs.report = flags.String("report", "", "Specify the path of the json run report, defaults to a new file in the report directory")
+	}
+	if cmd.process == Serve {
+		cmdArgs.schedule = flags.String("schedule", "", "Specify a 5 field cron schedule in Eastern time, defaults to the config file's schedule")
+	}
+	if cmd.takesDates() {
+		cmdArgs.date = flags.String("date", "", "Specify the game date to run, ex. 2024-10-22, yesterday or today-2")
+		cmdArgs.startDate = flags.String("start-date", "", "Specify the first game date of a range to run")
+		cmdArgs.endDate = flags.String("end-date", "", "Specify the last game date of a range to run, inclusive")
+		cmdArgs.season = flags.String("season", "", "Specify a season to run every date of, ex. 2024 for 2024-25")
+	}
+	if cmd.takesLocks() {
+		cmdArgs.forceUnlock = flags.Bool("force-unlock", false, "Remove the locks of the stages and dates to run before taking them, when the process holding them is gone")
+	}
+	if cmd.process == CleanAllGames || cmd.process == RunPipeline || cmd.process == Serve {
+		cmdArgs.sampling = flags.String("sampling", "", "Specify comma separated granularities to sample the play by play at besides 30s, ex. 5s/final3m, defaults to the config file's sampling.granularities")
+	}
+	if cmd.process == CombineGameWithOdds || cmd.process == RunPipeline || cmd.process == Serve {
+		cmdArgs.granularity = flags.String("granularity", "", "Specify the play by play granularity to export, ex. 5s/final3m, defaults to the config file's sampling.csvGranularity")
+	}
+	if cmd.process == RunPipeline || cmd.process == Serve {
+		cmdArgs.stages = flags.String("stages", "", "Specify a comma separated subset of stages to run")
+	}
+
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: nba_main %s [flags]\n\n%s\n\nFlags:\n", cmd.name, cmd.description)
+		flags.PrintDefaults()
+	}
+	return flags, cmdArgs
+}
+
+/* The scheduler picks its own dates, the migration and the concatenation cover every date, and the data dictionary and config have none */
+func (cmd command) takesDates() bool {
+	return cmd.process != Serve && cmd.process != MigrateToSqlite && cmd.process != ConcatCsvs &&
+		cmd.process != WriteDataDictionary && cmd.process != ShowConfig
+}
+
+/* Every stage serve runs writes its own report to the report directory, and status and config show only read */
+func (cmd command) writesReport() bool {
+	return cmd.process != Serve && cmd.process != Status && cmd.process != ShowConfig
+}
+
+/* config show prints yaml and status its matrix to stdout, so their log lines go to stderr to keep the output parseable */
+func (cmd command) printsToStdout() bool {
+	return cmd.process == ShowConfig || cmd.process == Status
+}
+
+/* Serve is left out, since a forced unlock on every scheduled run would defeat the locks */
+func (cmd command) takesLocks() bool {
+	return cmd.takesDates() && cmd.process != Status || cmd.process == ConcatCsvs
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: nba_main <command> [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-14s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintf(w, "\nRun 'nba_main <command> --help' for the flags of a command.\n")
+}
+
+func isHelpArg(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help"
+}
+
+func leadingWords(args []string) (words []string) {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") || len(words) == 2 {
+			break
+		}
+		words = append(words, arg)
+	}
+	return words
+}
+
+func valueOrEmpty(arg *string) string {
+	if arg == nil {
+		return ""
+	}
+	return *arg
+}
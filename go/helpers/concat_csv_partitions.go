@@ -0,0 +1,212 @@
+package helpers
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+Rebuilds the single file csvs read by historical_analysis.py from the month partitions. Partitions are
+read one at a time and their names sort by month, so the result keeps the sorted order of the partitions.
+Rows of the single file csvs from before the partitions are moved into them first, so none are lost
+*/
+func ConcatCsvPartitions(runId string) error {
+	lockFile := &csvLockFile{newPipelineLock(Config.Csv.Directory, ConcatCsvs, "", runId)}
+	return withLeases(context.Background(), []lease{lockFile}, func(ctx context.Context) error {
+		if err := moveLegacyCsvRows(ctx); err != nil {
+			return err
+		}
+		err1 := concatCsvPartitions(gamesCsv)
+		err2 := concatCsvPartitions(playsCsv)
+		return handleMultipleErrors(err1, err2)
+	})
+}
+
+func concatCsvPartitions(spec csvSpec) error {
+	partitions, err := filepath.Glob(filepath.Join(spec.partitionDirectory(), "*.csv"))
+	if err != nil {
+		return err
+	}
+
+	if DryRun {
+		var numRows int
+		for _, partition := range partitions {
+			rows, err := readCsvRows(spec, partition)
+			if err != nil {
+				return err
+			}
+			numRows += len(rows)
+		}
+		Logger.Info("Dry run: would write csv", "csv", spec.name(), "path", spec.legacyPath(), "partitions", len(partitions), "rows", numRows)
+		return nil
+	}
+
+	legacyGameIds, err := readCsvGameIds(spec, spec.legacyPath())
+	if err != nil {
+		return err
+	}
+	var numRows int
+	err = writeFileAtomically(spec.legacyPath(), func(w io.Writer) error {
+		writer := csv.NewWriter(w)
+		if err := writer.Write(spec.header); err != nil {
+			return err
+		}
+		for _, partition := range partitions {
+			rows, err := readCsvRows(spec, partition)
+			if err != nil {
+				return err
+			}
+			if err = writer.WriteAll(rows); err != nil {
+				return err
+			}
+			for _, row := range rows {
+				delete(legacyGameIds, spec.gameId(row))
+			}
+			numRows += len(rows)
+		}
+		return refuseToDropCsvGames(spec, legacyGameIds)
+	})
+	if err != nil {
+		return err
+	}
+	Logger.Info("Wrote csv", "csv", spec.name(), "path", spec.legacyPath(), "partitions", len(partitions), "rows", numRows)
+	return nil
+}
+
+/*
+Returning an error from the write leaves the single file csv as it was. Games are compared rather than rows,
+since an export replaces the rows of a game, see upsertCsv
+*/
+func refuseToDropCsvGames(spec csvSpec, missingGameIds map[string]bool) error {
+	if len(missingGameIds) == 0 {
+		return nil
+	}
+	var example string
+	for gameId := range missingGameIds {
+		example = gameId
+		break
+	}
+	return fmt.Errorf("refusing to overwrite %s, %d of its games are missing from the partitions in %s, ex. game %s. Move the file aside to rebuild it from the partitions",
+		spec.legacyPath(), len(missingGameIds), spec.partitionDirectory(), example)
+}
+
+func readCsvGameIds(spec csvSpec, path string) (map[string]bool, error) {
+	rows, err := readCsvRows(spec, path)
+	if err != nil {
+		return nil, err
+	}
+	gameIds := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		gameIds[spec.gameId(row)] = true
+	}
+	return gameIds, nil
+}
+
+/*
+The first export after upgrading from the single file csvs moves their rows into the month partitions,
+before a partition of the export's month exists and would leave the older rows behind
+*/
+func splitLegacyCsvsOnFirstExport(ctx context.Context) error {
+	for _, spec := range []csvSpec{gamesCsv, playsCsv} {
+		if _, err := os.Stat(spec.partitionDirectory()); errors.Is(err, os.ErrNotExist) {
+			return moveLegacyCsvRows(ctx)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Moves the rows of games missing from the partitions out of the single file csvs, into the partition of
+their month. Play rows have no date, so they go to the month of their game in the games csv
+*/
+func moveLegacyCsvRows(ctx context.Context) error {
+	gameMonths, err := moveLegacyCsvRowsOf(ctx, gamesCsv, nil)
+	if err != nil {
+		return err
+	}
+	_, err = moveLegacyCsvRowsOf(ctx, playsCsv, gameMonths)
+	return err
+}
+
+/* Returns the month of every game in the csv. Rows are placed by their game date, or by gameMonths when given */
+func moveLegacyCsvRowsOf(ctx context.Context, spec csvSpec, gameMonths map[string]string) (map[string]string, error) {
+	legacyRows, err := readCsvRows(spec, spec.legacyPath())
+	if err != nil {
+		return nil, err
+	}
+	partitions, err := filepath.Glob(filepath.Join(spec.partitionDirectory(), "*.csv"))
+	if err != nil {
+		return nil, err
+	}
+
+	partitionedGames := make(map[string]string)
+	for _, partition := range partitions {
+		rows, err := readCsvRows(spec, partition)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			partitionedGames[spec.gameId(row)] = strings.TrimSuffix(filepath.Base(partition), ".csv")
+		}
+	}
+
+	var numRows int
+	movedGames := make(map[string]string)
+	movedRows := make(map[string][][]string)
+	for _, row := range legacyRows {
+		gameId := spec.gameId(row)
+		if _, ok := partitionedGames[gameId]; ok {
+			continue
+		}
+		month, ok := gameMonths[gameId]
+		if gameMonths == nil {
+			month, ok = gameCsvMonth(row)
+		}
+		if !ok {
+			return nil, fmt.Errorf("found no game date for game %s of %s, export its games csv first", gameId, spec.legacyPath())
+		}
+		movedGames[gameId] = month
+		movedRows[month] = append(movedRows[month], row)
+		numRows += 1
+	}
+	for gameId, month := range movedGames {
+		partitionedGames[gameId] = month
+	}
+	if len(movedRows) == 0 {
+		return partitionedGames, nil
+	}
+
+	if DryRun {
+		loggerFrom(ctx).Info("Dry run: would move single file csv rows into partitions", "csv", spec.name(), "path", spec.legacyPath(), "rows", numRows, "games", len(movedGames), "partitions", len(movedRows))
+		return partitionedGames, nil
+	}
+	for month, rows := range movedRows {
+		path := filepath.Join(spec.partitionDirectory(), month+".csv")
+		existingRows, err := readCsvRows(spec, path)
+		if err != nil {
+			return nil, err
+		}
+		if err = writeCsvFile(path, spec, append(existingRows, rows...)); err != nil {
+			return nil, err
+		}
+	}
+	loggerFrom(ctx).Info("Moved single file csv rows into partitions", "csv", spec.name(), "path", spec.legacyPath(), "rows", numRows, "games", len(movedGames), "partitions", len(movedRows))
+	return partitionedGames, nil
+}
+
+/* The month partition of a games csv row, by its game date */
+func gameCsvMonth(row []string) (string, bool) {
+	date := row[gameDateColumn]
+	if len(date) < len("2006-01") {
+		return "", false
+	}
+	return date[:len("2006-01")], true
+}
@@ -0,0 +1,364 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+The config is layered: the defaults, then the config file, then the environment variables. Every field
+has an environment variable named NBA_<SECTION>_<KEY> after its yaml keys, ex. NBA_ODDSAPI_KEY or
+NBA_STATSAPI_REQUESTINTERVAL, so a deployment can run without a config file at all
+*/
+type configField struct {
+	path   string
+	envVar string
+	secret bool
+	value  reflect.Value
+}
+
+var durationType = reflect.TypeFor[time.Duration]()
+
+func configFields(cfg *NbaConfig) []configField {
+	var fields []configField
+	sections := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		sectionKey := yamlKey(sections.Type().Field(i))
+		section := sections.Field(i)
+		for j := 0; j < section.NumField(); j++ {
+			field := section.Type().Field(j)
+			key := yamlKey(field)
+			fields = append(fields, configField{
+				path:   sectionKey + "." + key,
+				envVar: configEnvVar(sectionKey + "." + key),
+				secret: field.Tag.Get("secret") == "true",
+				value:  section.Field(j),
+			})
+		}
+	}
+	return fields
+}
+
+func yamlKey(field reflect.StructField) string {
+	return strings.Split(field.Tag.Get("yaml"), ",")[0]
+}
+
+/* Set fields from the environment, empty variables included, so a variable can clear a file's value. Lists are comma separated */
+func applyEnvOverrides(cfg *NbaConfig) error {
+	var errs []error
+	for _, field := range configFields(cfg) {
+		if value, ok := os.LookupEnv(field.envVar); ok {
+			errs = append(errs, setConfigField(field, value))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func setConfigField(field configField, value string) error {
+	switch {
+	case field.value.Type() == durationType:
+		duration, err := time.ParseDuration(value)
+		if err != nil && value != "" {
+			return fmt.Errorf("%s must be a duration such as 500ms or 5m, got %q", field.envVar, value)
+		}
+		field.value.SetInt(int64(duration))
+	case field.value.Kind() == reflect.Int:
+		number, err := strconv.Atoi(value)
+		if err != nil && value != "" {
+			return fmt.Errorf("%s must be an integer, got %q", field.envVar, value)
+		}
+		field.value.SetInt(int64(number))
+	case field.value.Kind() == reflect.Bool:
+		enabled, err := strconv.ParseBool(value)
+		if err != nil && value != "" {
+			return fmt.Errorf("%s must be true or false, got %q", field.envVar, value)
+		}
+		field.value.SetBool(enabled)
+	case field.value.Kind() == reflect.String:
+		field.value.SetString(value)
+	case field.value.Type() == reflect.TypeFor[[]string]():
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.value.Set(reflect.ValueOf(items))
+	case field.value.Type() == reflect.TypeFor[[]int]():
+		var items []int
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			number, err := strconv.Atoi(item)
+			if err != nil {
+				return fmt.Errorf("%s must be a comma separated list of integers, got %q", field.envVar, value)
+			}
+			items = append(items, number)
+		}
+		field.value.Set(reflect.ValueOf(items))
+	default:
+		panic(fmt.Sprintf("config field %s has unsupported type %s", field.path, field.value.Type()))
+	}
+	return nil
+}
+
+/* Names of the environment variables overriding the config, for config show */
+func configEnvOverrides() []string {
+	var overrides []string
+	for _, field := range configFields(&NbaConfig{}) {
+		if _, ok := os.LookupEnv(field.envVar); ok {
+			overrides = append(overrides, field.envVar)
+		}
+	}
+	return overrides
+}
+
+/* Secrets can be read from files, ex. docker or kubernetes secrets, so they stay out of the config file */
+func readSecretFiles(cfg *NbaConfig) error {
+	return handleMultipleErrors(
+		readSecretFile("oddsApi.key", &cfg.OddsApi.Key, cfg.OddsApi.KeyFile),
+		readSecretFile("database.password", &cfg.Database.Password, cfg.Database.PasswordFile),
+	)
+}
+
+/* Trailing newlines are trimmed, since editors and echo add one to secret files */
+func readSecretFile(path string, value *string, secretFile string) error {
+	if secretFile == "" {
+		return nil
+	}
+	if *value != "" {
+		return fmt.Errorf("%s and %sFile are both set, set only one of them or of %s and %sFILE",
+			path, path, configEnvVar(path), configEnvVar(path))
+	}
+	contents, err := os.ReadFile(secretFile)
+	if err != nil {
+		return fmt.Errorf("error reading %sFile: %w", path, err)
+	}
+	*value = strings.TrimRight(string(contents), "\r\n")
+	if *value == "" {
+		return fmt.Errorf("%sFile %s is empty", path, secretFile)
+	}
+	return nil
+}
+
+func configEnvVar(path string) string {
+	return strings.ToUpper(configEnvPrefix + strings.ReplaceAll(path, ".", "_"))
+}
+
+/*
+Checks the whole config before anything runs, returning every problem at once. Fields only some
+processes use, ex. the odds api key, are only required when the process and its stages use them
+*/
+func validateConfig(cfg *NbaConfig, process ProcessType, stages []ProcessType) error {
+	var errs []error
+	invalid := func(path string, message string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s (%s) %s", path, configEnvVar(path), fmt.Sprintf(message, args...)))
+	}
+
+	backends := []string{mongoBackend, memoryBackend, sqliteBackend}
+	if !slices.Contains(backends, cfg.Database.Backend) {
+		invalid("database.backend", "must be one of %s, got %q", strings.Join(backends, ", "), cfg.Database.Backend)
+	}
+	if cfg.Database.Backend == mongoBackend || process == MigrateToSqlite {
+		validateMongoConfig(cfg.Database, invalid)
+	}
+	if cfg.Database.SeedDirectory != "" && cfg.Database.Backend == memoryBackend {
+		if info, err := os.Stat(cfg.Database.SeedDirectory); err != nil || !info.IsDir() {
+			invalid("database.seedDirectory", "must be an existing directory, got %q", cfg.Database.SeedDirectory)
+		}
+	}
+
+	if usesStage(process, stages, FetchRawOdds) {
+		if cfg.OddsApi.Key == "" {
+			invalid("oddsApi.key", "is required to fetch odds, set it or oddsApi.keyFile (NBA_ODDSAPI_KEYFILE)")
+		}
+		if !isHttpUrl(cfg.OddsApi.BaseUrl) {
+			invalid("oddsApi.baseUrl", "must be an http or https url, got %q", cfg.OddsApi.BaseUrl)
+		}
+	}
+	if usesStage(process, stages, FetchRawGames) && !isHttpUrl(cfg.StatsApi.BaseUrl) {
+		invalid("statsApi.baseUrl", "must be an http or https url, got %q", cfg.StatsApi.BaseUrl)
+	}
+	if cfg.StatsApi.RequestInterval < 0 {
+		invalid("statsApi.requestInterval", "must not be negative, got %s", cfg.StatsApi.RequestInterval)
+	}
+	if cfg.StatsApi.Timeout <= 0 {
+		invalid("statsApi.timeout", "must be positive, got %s", cfg.StatsApi.Timeout)
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Logging.Level)); err != nil {
+		invalid("logging.level", "must be one of debug, info, warn or error, got %q", cfg.Logging.Level)
+	}
+	if format := strings.ToLower(cfg.Logging.Format); format != "json" && format != "logfmt" {
+		invalid("logging.format", "must be json or logfmt, got %q", cfg.Logging.Format)
+	}
+	if cfg.Logging.MaxSizeMb < 0 {
+		invalid("logging.maxSizeMb", "must not be negative, got %d", cfg.Logging.MaxSizeMb)
+	}
+	if cfg.Logging.MaxBackups < 0 {
+		invalid("logging.maxBackups", "must not be negative, got %d", cfg.Logging.MaxBackups)
+	}
+
+	if cfg.Metrics.ListenAddress != "" {
+		if _, _, err := net.SplitHostPort(cfg.Metrics.ListenAddress); err != nil {
+			invalid("metrics.listenAddress", "must be a host and port such as :9464, got %q", cfg.Metrics.ListenAddress)
+		}
+	}
+
+	if _, err := parseCronSchedule(cfg.Scheduler.Schedule); err != nil {
+		invalid("scheduler.schedule", "is invalid: %v", err)
+	}
+	if cfg.Scheduler.Retries < 0 {
+		invalid("scheduler.retries", "must not be negative, got %d", cfg.Scheduler.Retries)
+	}
+	if cfg.Scheduler.RetryDelay < 0 {
+		invalid("scheduler.retryDelay", "must not be negative, got %s", cfg.Scheduler.RetryDelay)
+	}
+
+	if !strings.HasPrefix(cfg.OddsApi.HistoricalOddsPath, "/") {
+		invalid("oddsApi.historicalOddsPath", "must start with /, got %q", cfg.OddsApi.HistoricalOddsPath)
+	}
+	if duplicate, ok := findDuplicate(cfg.Odds.Bookmakers); ok {
+		invalid("odds.bookmakers", "lists %s more than once", duplicate)
+	}
+	for _, hour := range cfg.Odds.SnapshotUtcHours {
+		if hour < 0 || hour > 23 {
+			invalid("odds.snapshotUtcHours", "must be hours between 0 and 23, got %d", hour)
+		}
+	}
+	/* The latest snapshot before a game is found by walking the hours in order */
+	if !slices.IsSorted(cfg.Odds.SnapshotUtcHours) {
+		invalid("odds.snapshotUtcHours", "must be in increasing order, got %v", cfg.Odds.SnapshotUtcHours)
+	}
+	if duplicate, ok := findDuplicate(cfg.Odds.SnapshotUtcHours); ok {
+		invalid("odds.snapshotUtcHours", "lists %d more than once", duplicate)
+	}
+	for _, csvFile := range [][2]string{{"csv.gamesFileName", cfg.Csv.GamesFileName}, {"csv.playsFileName", cfg.Csv.PlaysFileName}} {
+		if !strings.HasSuffix(csvFile[1], ".csv") || strings.ContainsAny(csvFile[1], `/\`) {
+			invalid(csvFile[0], "must be a file name ending in .csv, got %q", csvFile[1])
+		}
+	}
+	if cfg.Csv.GamesFileName == cfg.Csv.PlaysFileName {
+		invalid("csv.playsFileName", "must differ from csv.gamesFileName, got %q for both", cfg.Csv.PlaysFileName)
+	}
+	for _, granularity := range cfg.Sampling.Granularities {
+		if _, err := parseGranularity(granularity); err != nil {
+			invalid("sampling.granularities", "%v", err)
+		}
+	}
+	if duplicate, ok := findDuplicate(cfg.Sampling.Granularities); ok {
+		invalid("sampling.granularities", "lists %s more than once", duplicate)
+	}
+	if _, err := parseGranularity(cfg.Sampling.CsvGranularity); err != nil {
+		invalid("sampling.csvGranularity", "%v", err)
+	}
+	collectionPaths := make(map[string]string)
+	for _, field := range configFields(cfg) {
+		if !strings.HasPrefix(field.path, "collections.") {
+			continue
+		}
+		if otherPath, ok := collectionPaths[field.value.String()]; ok {
+			invalid(field.path, "must differ from %s, got %q for both", otherPath, field.value.String())
+		}
+		collectionPaths[field.value.String()] = field.path
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func validateMongoConfig(database DatabaseConfig, invalid func(path string, message string, args ...interface{})) {
+	if database.Schema == "" {
+		invalid("database.schema", "is required with MongoDB")
+	}
+	if database.Uri != "" {
+		if !strings.HasPrefix(database.Uri, "mongodb://") && !strings.HasPrefix(database.Uri, "mongodb+srv://") {
+			invalid("database.uri", "must start with mongodb:// or mongodb+srv://")
+		}
+	} else {
+		if database.Host == "" {
+			invalid("database.host", "is required with MongoDB, unless database.uri is set")
+		}
+		if port, err := strconv.Atoi(database.Port); err != nil || port < 1 || port > 65535 {
+			invalid("database.port", "must be a port number between 1 and 65535, got %q", database.Port)
+		}
+	}
+	if database.Password != "" && database.Username == "" {
+		invalid("database.username", "is required when database.password is set")
+	}
+	if database.TlsCaFile != "" {
+		if info, err := os.Stat(database.TlsCaFile); err != nil || info.IsDir() {
+			invalid("database.tlsCaFile", "must be an existing PEM file, got %q", database.TlsCaFile)
+		}
+	}
+	if database.ConnectTimeout <= 0 {
+		invalid("database.connectTimeout", "must be positive, got %s", database.ConnectTimeout)
+	}
+	if database.ServerSelectionTimeout <= 0 {
+		invalid("database.serverSelectionTimeout", "must be positive, got %s", database.ServerSelectionTimeout)
+	}
+	if database.OperationTimeout < 0 {
+		invalid("database.operationTimeout", "must not be negative, got %s", database.OperationTimeout)
+	}
+}
+
+func findDuplicate[T comparable](items []T) (T, bool) {
+	seen := make(map[T]bool, len(items))
+	for _, item := range items {
+		if seen[item] {
+			return item, true
+		}
+		seen[item] = true
+	}
+	var zero T
+	return zero, false
+}
+
+/* Whether the process is the stage, or runs it as one of its pipeline stages */
+func usesStage(process ProcessType, stages []ProcessType, stage ProcessType) bool {
+	if process == RunPipeline || process == Serve {
+		return slices.Contains(stages, stage)
+	}
+	return process == stage
+}
+
+func isHttpUrl(rawUrl string) bool {
+	parsed, err := url.Parse(rawUrl)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+/* Prints the effective config as yaml, with the secrets redacted */
+func PrintConfig(w io.Writer) error {
+	redacted := *Config
+	for _, field := range configFields(&redacted) {
+		if field.secret && field.value.String() != "" {
+			field.value.SetString(redactedConfigValue)
+		}
+	}
+
+	contents, err := yaml.Marshal(redacted)
+	if err != nil {
+		return err
+	}
+	if overrides := configEnvOverrides(); len(overrides) > 0 {
+		fmt.Fprintf(w, "# Overridden by the environment: %s\n", strings.Join(overrides, ", "))
+	}
+	_, err = w.Write(contents)
+	return err
+}
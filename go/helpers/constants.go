@@ -4,46 +4,133 @@ package helpers
 
 import (
 	"errors"
-	"log"
+	"log/slog"
+	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 /* Globals */
-var Logger *log.Logger
+var Logger *slog.Logger
 var Config *NbaConfig
+var DryRun bool
+var Workers int = 1
+var Lenient bool
+var ForceUnlock bool
+
+/* Run id of the invocation. Runs started by serve get a run id of their own */
+var processRunId string
 
 /* Config specific variables */
-var logFilePath string = "logs/nba_game_processing.log"
-var oddsSourceApiPath string = "/v4/historical/sports/basketball_nba/odds"
-
-/* CSV generation specifics */
-var csvDirectory string = "csvs"
-var gamesCsvName string = "games_summary_data.csv"
-var playsCsvName string = "game_play_by_play_data.csv"
-
-/* Odds sourcing specifics */
-var utcHoursForLookup = []int{16, 21, 23}
-
-var bookmakersPriority map[string]int = map[string]int{
-	"fanduel":        1,
-	"draftkings":     2,
-	"williamhill_us": 3,
-	"betmgm":         4,
+var configEnvPrefix string = "NBA_"
+var redactedConfigValue string = "<redacted>"
+var defaultOddsApiBaseUrl string = "https://api.the-odds-api.com"
+var defaultOddsApiHistoricalOddsPath string = "/v4/historical/sports/basketball_nba/odds"
+var defaultLogFilePath string = "logs/nba_game_processing.log"
+var defaultLogLevel string = "info"
+var defaultLogFormat string = "json"
+var defaultLogMaxSizeMb int = 50
+var defaultLogMaxBackups int = 5
+var defaultReportDirectory string = "logs/reports"
+var defaultDatabaseBackend string = mongoBackend
+var defaultSqlitePath string = "data/nba.sqlite"
+
+/* Shorter than the driver's 30 second defaults, so an unreachable MongoDB fails the run quickly */
+var defaultMongoConnectTimeout time.Duration = 10 * time.Second
+var defaultMongoServerSelectionTimeout time.Duration = 10 * time.Second
+
+/* Scheduler defaults mirror the airflow DAG's retries */
+var defaultSchedule string = "0 6 * * *"
+var defaultSchedulerStateFile string = "logs/scheduler_state.json"
+var defaultSchedulerRetries int = 3
+var defaultSchedulerRetryDelay time.Duration = 5 * time.Minute
+
+/* Locks expire unless renewed, so a crashed process only blocks the stage for one lease */
+var lockLeaseDuration time.Duration = 5 * time.Minute
+var lockRenewInterval time.Duration = time.Minute
+var csvLockFileName string = ".lock"
+
+/* CSV generation defaults, see the csv section of the config. Each csv is partitioned by month under a directory named after it */
+var defaultCsvDirectory string = "csvs"
+var defaultGamesCsvFileName string = "games_summary_data.csv"
+var defaultPlaysCsvFileName string = "game_play_by_play_data.csv"
+
+/* Data dictionary of the csvs, a JSON Schema per csv and a markdown table of every column */
+var dataDictionaryDirectory string = "schema"
+var dataDictionaryMarkdownName string = "data_dictionary.md"
+
+/* Parquet export specifics, one file per game date under <csv.parquetDirectory>/<table>/season=<year> */
+var defaultParquetDirectory string = "parquet"
+var gamesParquetTable string = "games_summary_data"
+var playsParquetTable string = "game_play_by_play_data"
+
+/* Play by play sampling specifics, see sampling.go */
+var defaultGranularity string = "30s"
+
+/* Game clock specifics. Regulation has 4 quarters of 12 minutes, each overtime period lasts 5 */
+var regulationPeriods int32 = 4
+var quarterSeconds int32 = 12 * 60
+var overtimeSeconds int32 = 5 * 60
+
+/* Date handling specifics */
+var dateLayout string = "2006-01-02"
+var defaultLagDays int = 2
+
+/*
+Calendar of each season, by its starting year: opening night, the first play-in date for seasons with a
+play-in tournament, the first playoff date and the last day of the finals. Seasons missing here fail --season
+and games fetch, add them as their schedules are released
+*/
+var seasonCalendars = map[string]seasonCalendar{
+	"2015": {start: "2015-10-27", playoffStart: "2016-04-16", end: "2016-06-19"},
+	"2016": {start: "2016-10-25", playoffStart: "2017-04-15", end: "2017-06-12"},
+	"2017": {start: "2017-10-17", playoffStart: "2018-04-14", end: "2018-06-08"},
+	"2018": {start: "2018-10-16", playoffStart: "2019-04-13", end: "2019-06-13"},
+	"2019": {start: "2019-10-22", playInStart: "2020-08-15", playoffStart: "2020-08-17", end: "2020-10-11"},
+	"2020": {start: "2020-12-22", playInStart: "2021-05-18", playoffStart: "2021-05-22", end: "2021-07-20"},
+	"2021": {start: "2021-10-19", playInStart: "2022-04-12", playoffStart: "2022-04-16", end: "2022-06-16"},
+	"2022": {start: "2022-10-18", playInStart: "2023-04-11", playoffStart: "2023-04-15", end: "2023-06-12"},
+	"2023": {start: "2023-10-24", playInStart: "2024-04-16", playoffStart: "2024-04-20", end: "2024-06-17"},
+	"2024": {start: "2024-10-22", playInStart: "2025-04-15", playoffStart: "2025-04-19", end: "2025-06-22"},
 }
 
+/* Game sourcing specifics */
+var teamGameLogEndpoint string = "teamgamelog"
+var playByPlayEndpoint string = "playbyplay"
+var statsApiDateLayout string = "01/02/2006"
+var statsApiRetries int = 3
+var statsApiDefaultRetryDelay time.Duration = 5 * time.Second
+var statsApiMaxResponseBytes int64 = 64 << 20
+var defaultStatsApiBaseUrl string = "https://stats.nba.com/stats"
+var defaultStatsApiRequestInterval time.Duration = 600 * time.Millisecond
+var defaultStatsApiTimeout time.Duration = 30 * time.Second
+
+/* Odds sourcing defaults, see the odds section of the config. Bookmakers are in order of preference */
+var defaultSnapshotUtcHours = []int{16, 21, 23}
+var defaultBookmakers = []string{"fanduel", "draftkings", "williamhill_us", "betmgm"}
+
 /* Process type parameter makeshift enum */
 type ProcessType string
 
 const (
+	FetchRawGames       ProcessType = "fetch_raw_games"
 	FetchRawOdds        ProcessType = "fetch_raw_odds"
 	CleanAllGames       ProcessType = "clean_games"
 	CleanRawOdds        ProcessType = "clean_raw_odds"
 	CombineGameWithOdds ProcessType = "combine_game_and_odds"
+	RunPipeline         ProcessType = "run_pipeline"
+	Serve               ProcessType = "serve"
+	Status              ProcessType = "status"
+	MigrateToSqlite     ProcessType = "migrate_to_sqlite"
+	ConcatCsvs          ProcessType = "concat_csvs"
+	WriteDataDictionary ProcessType = "write_data_dictionary"
+	ShowConfig          ProcessType = "show_config"
 )
 
 func ValueOf(processName string) (ProcessType, error) {
 	switch processName {
+	case "fetch_raw_games":
+		return FetchRawGames, nil
 	case "fetch_raw_odds":
 		return FetchRawOdds, nil
 	case "clean_games":
@@ -52,34 +139,71 @@ func ValueOf(processName string) (ProcessType, error) {
 		return CleanRawOdds, nil
 	case "combine_game_and_odds":
 		return CombineGameWithOdds, nil
+	case "run_pipeline":
+		return RunPipeline, nil
+	case "serve":
+		return Serve, nil
+	case "status":
+		return Status, nil
+	case "migrate_to_sqlite":
+		return MigrateToSqlite, nil
+	case "concat_csvs":
+		return ConcatCsvs, nil
+	case "write_data_dictionary":
+		return WriteDataDictionary, nil
+	case "show_config":
+		return ShowConfig, nil
 	default:
 		return "", errors.New("found unknown process type")
 	}
 }
 
 /* Database related constants */
-var cleanedGamesCollectionName = "cleanedGameData"
-var cleanedOddsCollectionName = "cleanedOdds"
-var historicalOddsCollectionName = "rawHistoricalOdds"
-var rawGamesCollectionName = "rawGames"
-var teamMetadataCollectionName = "teamMetadata"
+var mongoBackend = "mongo"
+var memoryBackend = "memory"
+var sqliteBackend = "sqlite"
+var migrationBatchSize = 500
+
+/* Collection name defaults, see the collections section of the config */
+var defaultCollections = CollectionsConfig{
+	CleanedGames:     "cleanedGameData",
+	CleanedOdds:      "cleanedOdds",
+	RawOdds:          "rawHistoricalOdds",
+	PipelineLocks:    "pipelineLocks",
+	PipelineRuns:     "pipelineRuns",
+	ProcessingErrors: "processingErrors",
+	RawGames:         "rawGames",
+	TeamMetadata:     "teamMetadata",
+}
 
 func getCleanedGamesCollection(client *mongo.Client, schemaName string) *mongo.Collection {
-	return client.Database(schemaName).Collection(cleanedGamesCollectionName)
+	return client.Database(schemaName).Collection(Config.Collections.CleanedGames)
 }
 
 func getCleanedOddsCollection(client *mongo.Client, schemaName string) *mongo.Collection {
-	return client.Database(schemaName).Collection(cleanedOddsCollectionName)
+	return client.Database(schemaName).Collection(Config.Collections.CleanedOdds)
 }
 
 func getHistoricalOddscollection(client *mongo.Client, schemaName string) *mongo.Collection {
-	return client.Database(schemaName).Collection(historicalOddsCollectionName)
+	return client.Database(schemaName).Collection(Config.Collections.RawOdds)
+}
+
+func getPipelineLocksCollection(client *mongo.Client, schemaName string) *mongo.Collection {
+	return client.Database(schemaName).Collection(Config.Collections.PipelineLocks)
+}
+
+func getPipelineRunsCollection(client *mongo.Client, schemaName string) *mongo.Collection {
+	return client.Database(schemaName).Collection(Config.Collections.PipelineRuns)
+}
+
+func getProcessingErrorsCollection(client *mongo.Client, schemaName string) *mongo.Collection {
+	return client.Database(schemaName).Collection(Config.Collections.ProcessingErrors)
 }
 
 func getRawGamesCollection(client *mongo.Client, schemaName string) *mongo.Collection {
-	return client.Database(schemaName).Collection(rawGamesCollectionName)
+	return client.Database(schemaName).Collection(Config.Collections.RawGames)
 }
 
 func getTeamMetadataCollection(client *mongo.Client, schemaName string) *mongo.Collection {
-	return client.Database(schemaName).Collection(teamMetadataCollectionName)
+	return client.Database(schemaName).Collection(Config.Collections.TeamMetadata)
 }
@@ -0,0 +1,126 @@
+package helpers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Five field cron schedules: minute, hour, day of month, month and day of week. Fields accept *,
+single values, ranges, lists and steps, ex. "30 6 * * *" for 6:30 every day
+*/
+type cronSchedule struct {
+	minutes       [60]bool
+	hours         [24]bool
+	daysOfMonth   [32]bool
+	months        [13]bool
+	daysOfWeek    [7]bool
+	anyDayOfMonth bool
+	anyDayOfWeek  bool
+}
+
+func parseCronSchedule(expression string) (*cronSchedule, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, errors.New("cron schedule must have 5 fields: " + expression)
+	}
+
+	var schedule cronSchedule
+	err1 := parseCronField(fields[0], 0, 59, schedule.minutes[:])
+	err2 := parseCronField(fields[1], 0, 23, schedule.hours[:])
+	err3 := parseCronField(fields[2], 1, 31, schedule.daysOfMonth[:])
+	err4 := parseCronField(fields[3], 1, 12, schedule.months[:])
+	var daysOfWeek [8]bool
+	err5 := parseCronField(fields[4], 0, 7, daysOfWeek[:])
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || err5 != nil {
+		return nil, errors.New("invalid cron schedule " + expression + ": " + handleMultipleErrors(err1, err2, err3, err4, err5).Error())
+	}
+
+	/* Both 0 and 7 are Sunday */
+	copy(schedule.daysOfWeek[:], daysOfWeek[:7])
+	schedule.daysOfWeek[0] = schedule.daysOfWeek[0] || daysOfWeek[7]
+	schedule.anyDayOfMonth = fields[2] == "*"
+	schedule.anyDayOfWeek = fields[4] == "*"
+	return &schedule, nil
+}
+
+func parseCronField(field string, min int, max int, matches []bool) error {
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rangePart = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return errors.New("invalid step in field " + field)
+			}
+		}
+
+		start, end := min, max
+		if rangePart != "*" {
+			var err1, err2 error
+			bounds := strings.SplitN(rangePart, "-", 2)
+			start, err1 = strconv.Atoi(bounds[0])
+			end, err2 = start, nil
+			if len(bounds) == 2 {
+				end, err2 = strconv.Atoi(bounds[1])
+			} else if step > 1 {
+				end = max
+			}
+			if err1 != nil || err2 != nil || start < min || end > max || start > end {
+				return errors.New("invalid value in field " + field)
+			}
+		}
+
+		for value := start; value <= end; value += step {
+			matches[value] = true
+		}
+	}
+	return nil
+}
+
+/* Returns the first matching minute strictly after the given time, in that time's location */
+func (schedule *cronSchedule) next(after time.Time) (time.Time, error) {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !schedule.months[t.Month()]:
+			t = laterOf(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location()))
+		case !schedule.matchesDay(t):
+			t = laterOf(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location()))
+		case !schedule.hours[t.Hour()]:
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+		case !schedule.minutes[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("cron schedule never matches")
+}
+
+/* Like cron, when both day fields are restricted a day matching either one matches */
+func (schedule *cronSchedule) matchesDay(t time.Time) bool {
+	dayOfMonth := schedule.daysOfMonth[t.Day()]
+	dayOfWeek := schedule.daysOfWeek[t.Weekday()]
+	switch {
+	case schedule.anyDayOfMonth && schedule.anyDayOfWeek:
+		return true
+	case schedule.anyDayOfMonth:
+		return dayOfWeek
+	case schedule.anyDayOfWeek:
+		return dayOfMonth
+	default:
+		return dayOfMonth || dayOfWeek
+	}
+}
+
+/* Local midnights can fall in a daylight saving gap and normalize to before t, so always move forward */
+func laterOf(t time.Time, next time.Time) time.Time {
+	if next.After(t) {
+		return next
+	}
+	return t.Add(time.Hour)
+}
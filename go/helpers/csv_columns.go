@@ -0,0 +1,242 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+/*
+Csv rows are structs, ex. GameCsv, whose csv tags name the columns in order. The header, the formatting
+and parsing of every value and the data dictionary all come from the struct, so they can't drift apart
+*/
+type csvColumn struct {
+	name        string
+	field       int
+	kind        reflect.Kind
+	format      string
+	description string
+}
+
+func csvColumns(rowType reflect.Type) []csvColumn {
+	columns := make([]csvColumn, 0, rowType.NumField())
+	for i := 0; i < rowType.NumField(); i++ {
+		field := rowType.Field(i)
+		if name, ok := field.Tag.Lookup("csv"); ok {
+			columns = append(columns, csvColumn{name, i, field.Type.Kind(), field.Tag.Get("format"), field.Tag.Get("description")})
+		}
+	}
+	return columns
+}
+
+func csvHeader(rowType reflect.Type) []string {
+	var header []string
+	for _, column := range csvColumns(rowType) {
+		header = append(header, column.name)
+	}
+	return header
+}
+
+/* Index of a column in the csv of T, so rows are read by column name rather than by position */
+func csvColumnIndex[T any](name string) int {
+	rowType := reflect.TypeFor[T]()
+	index := slices.Index(csvHeader(rowType), name)
+	if index < 0 {
+		panic(fmt.Sprintf("csv of %s has no column %s", rowType.Name(), name))
+	}
+	return index
+}
+
+/* Floats are written at their own precision, so a float32 price of 1.91 is written as 1.91 */
+func marshalCsvRow(row interface{}) []string {
+	value := reflect.ValueOf(row)
+	columns := csvColumns(value.Type())
+	record := make([]string, len(columns))
+	for i, column := range columns {
+		field := value.Field(column.field)
+		switch column.kind {
+		case reflect.String:
+			record[i] = field.String()
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			record[i] = strconv.FormatInt(field.Int(), 10)
+		case reflect.Float32, reflect.Float64:
+			record[i] = strconv.FormatFloat(field.Float(), 'f', -1, field.Type().Bits())
+		default:
+			panic(fmt.Sprintf("csv column %s has unsupported type %s", column.name, field.Type()))
+		}
+	}
+	return record
+}
+
+/* Expects the columns in the struct's order, which readCsvRows checks against the header */
+func unmarshalCsvRow[T any](record []string) (row T, err error) {
+	value := reflect.ValueOf(&row).Elem()
+	columns := csvColumns(value.Type())
+	if len(record) != len(columns) {
+		return row, fmt.Errorf("csv row has %d values for %d columns", len(record), len(columns))
+	}
+	for i, column := range columns {
+		field := value.Field(column.field)
+		switch column.kind {
+		case reflect.String:
+			field.SetString(record[i])
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			var parsed int64
+			parsed, err = strconv.ParseInt(record[i], 10, field.Type().Bits())
+			field.SetInt(parsed)
+		case reflect.Float32, reflect.Float64:
+			var parsed float64
+			parsed, err = strconv.ParseFloat(record[i], field.Type().Bits())
+			field.SetFloat(parsed)
+		default:
+			panic(fmt.Sprintf("csv column %s has unsupported type %s", column.name, field.Type()))
+		}
+		if err != nil {
+			return row, fmt.Errorf("error parsing csv column %s: %w", column.name, err)
+		}
+	}
+	return row, nil
+}
+
+func unmarshalCsvRows[T any](records [][]string) ([]T, error) {
+	rows := make([]T, 0, len(records))
+	for _, record := range records {
+		row, err := unmarshalCsvRow[T](record)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+/*
+Writes a JSON Schema of each csv's rows, with the properties in column order, and a markdown table of
+the columns, so the analysis scripts look columns up by name and type instead of hardcoding indices
+*/
+func WriteCsvDataDictionary() error {
+	directory := filepath.Join(Config.Csv.Directory, dataDictionaryDirectory)
+	if !DryRun {
+		if err := os.MkdirAll(directory, 0755); err != nil {
+			return err
+		}
+	}
+
+	var markdown bytes.Buffer
+	markdown.WriteString("# Data dictionary\n\nGenerated by `nba_main export dictionary` from the csv row structs in go/helpers/type_definitions.go.\n")
+	for _, spec := range []csvSpec{gamesCsv, playsCsv} {
+		schema, err := json.MarshalIndent(csvJsonSchema(spec), "", "  ")
+		if err != nil {
+			return err
+		}
+		schemaPath := filepath.Join(directory, strings.TrimSuffix(spec.name(), ".csv")+".json")
+		if err = writeDataDictionaryFile(schemaPath, append(schema, '\n')); err != nil {
+			return err
+		}
+		writeCsvMarkdown(&markdown, spec)
+	}
+	return writeDataDictionaryFile(filepath.Join(directory, dataDictionaryMarkdownName), markdown.Bytes())
+}
+
+func writeDataDictionaryFile(path string, contents []byte) error {
+	if DryRun {
+		Logger.Info("Dry run: would write data dictionary", "path", path)
+		return nil
+	}
+	err := writeFileAtomically(path, func(w io.Writer) error {
+		_, err := w.Write(contents)
+		return err
+	})
+	if err == nil {
+		Logger.Info("Wrote data dictionary", "path", path)
+	}
+	return err
+}
+
+type jsonSchema struct {
+	Schema               string               `json:"$schema"`
+	Title                string               `json:"title"`
+	Description          string               `json:"description"`
+	Type                 string               `json:"type"`
+	Properties           jsonSchemaProperties `json:"properties"`
+	Required             []string             `json:"required"`
+	AdditionalProperties bool                 `json:"additionalProperties"`
+}
+
+type jsonSchemaProperty struct {
+	name        string
+	Type        string `json:"type"`
+	Format      string `json:"format,omitempty"`
+	Description string `json:"description"`
+}
+
+/* Marshalled as an object keeping the column order, which a map would sort */
+type jsonSchemaProperties []jsonSchemaProperty
+
+func (properties jsonSchemaProperties) MarshalJSON() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+	for i, property := range properties {
+		name, err1 := json.Marshal(property.name)
+		value, err2 := json.Marshal(property)
+		if err1 != nil || err2 != nil {
+			return nil, handleMultipleErrors(err1, err2)
+		}
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		buffer.Write(name)
+		buffer.WriteByte(':')
+		buffer.Write(value)
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes(), nil
+}
+
+func csvJsonSchema(spec csvSpec) jsonSchema {
+	schema := jsonSchema{
+		Schema:      "https://json-schema.org/draft/2020-12/schema",
+		Title:       spec.name(),
+		Description: spec.description,
+		Type:        "object",
+		Required:    spec.header,
+	}
+	for _, column := range csvColumns(spec.rowType) {
+		schema.Properties = append(schema.Properties, jsonSchemaProperty{
+			name:        column.name,
+			Type:        jsonSchemaType(column.kind),
+			Format:      column.format,
+			Description: column.description,
+		})
+	}
+	return schema
+}
+
+func jsonSchemaType(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	default:
+		return "string"
+	}
+}
+
+func writeCsvMarkdown(markdown *bytes.Buffer, spec csvSpec) {
+	fmt.Fprintf(markdown, "\n## %s\n\n%s.\n\n| Index | Column | Type | Description |\n| --- | --- | --- | --- |\n", spec.name(), spec.description)
+	for i, column := range csvColumns(spec.rowType) {
+		columnType := jsonSchemaType(column.kind)
+		if column.format != "" {
+			columnType += " (" + column.format + ")"
+		}
+		fmt.Fprintf(markdown, "| %d | %s | %s | %s |\n", i, column.name, columnType, column.description)
+	}
+}
@@ -0,0 +1,57 @@
+package helpers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCsvRowsRoundTrip(t *testing.T) {
+	game := GameCsv{
+		GameId:               "0022400061",
+		SeasonId:             "22024",
+		Date:                 "2024-10-22",
+		StartTime:            "7:30 PM",
+		AwayTeamAbbreviation: "MIN",
+		AwayTeamId:           1610612750,
+		HomeTeamAbbreviation: "LAL",
+		HomeTeamId:           1610612747,
+		AwayMl:               1.91,
+		HomeMl:               1.95,
+		AwaySpread:           -1.5,
+		HomeSpread:           1.5,
+		PregameTotal:         224.5,
+		AwayFinalScore:       103,
+		HomeFinalScore:       110,
+		Overtime:             1,
+		OvertimePeriods:      1,
+	}
+	record := marshalCsvRow(game)
+	want := []string{"0022400061", "22024", "2024-10-22", "7:30 PM", "MIN", "1610612750", "LAL", "1610612747",
+		"1.91", "1.95", "-1.5", "1.5", "224.5", "103", "110", "1", "1"}
+	if !reflect.DeepEqual(record, want) {
+		t.Errorf("marshalled game: got %v, want %v", record, want)
+	}
+	games, err := unmarshalCsvRows[GameCsv]([][]string{record})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(games, []GameCsv{game}) {
+		t.Errorf("unmarshalled game: got %+v, want %+v", games, game)
+	}
+
+	play := PlayByPlayCsv{GameId: "0022400061", SecondsElapsed: 2910, Period: 5, SecondsRemaining: 270, AwayScore: 103, HomeScore: 110, UnderdogScore: 110, FavoriteScore: 103, FavoriteMargin: -7}
+	plays, err := unmarshalCsvRows[PlayByPlayCsv]([][]string{marshalCsvRow(play)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(plays, []PlayByPlayCsv{play}) {
+		t.Errorf("unmarshalled play: got %+v, want %+v", plays, play)
+	}
+
+	if _, err = unmarshalCsvRow[PlayByPlayCsv]([]string{"0022400061", "thirty", "1", "690", "3", "2", "2", "3", "1"}); err == nil {
+		t.Error("expected an error for a value that doesn't parse")
+	}
+	if _, err = unmarshalCsvRow[PlayByPlayCsv]([]string{"0022400061", "30"}); err == nil {
+		t.Error("expected an error for a row missing columns")
+	}
+}
@@ -0,0 +1,152 @@
+package helpers
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Funcs for resolving date parameters into game dates. Lag days only apply when no date is given, so an
+explicit --lag-days alongside a date is an error rather than silently ignored
+*/
+func resolveRunDates(date string, startDate string, endDate string, season string, lagDays int, lagDaysSet bool, now time.Time) ([]string, error) {
+	noDates := date == "" && startDate == "" && endDate == "" && season == ""
+	if lagDays < 0 {
+		return nil, errors.New("lag days must not be negative")
+	}
+	if lagDaysSet && !noDates {
+		return nil, errors.New("--lag-days only applies when no date is given, drop it or the date flags")
+	}
+
+	switch {
+	case noDates:
+		return []string{gameDateToday(now).AddDate(0, 0, -lagDays).Format(dateLayout)}, nil
+	case date != "" && startDate == "" && endDate == "" && season == "":
+		gameDate, err := resolveDateExpression(date, now)
+		if err != nil {
+			return nil, err
+		}
+		return []string{gameDate}, nil
+	case date == "" && startDate != "" && endDate != "" && season == "":
+		start, err1 := resolveDateExpression(startDate, now)
+		end, err2 := resolveDateExpression(endDate, now)
+		if err1 != nil || err2 != nil {
+			return nil, handleMultipleErrors(err1, err2)
+		}
+		return expandDateRange(start, end)
+	case date == "" && startDate == "" && endDate == "" && season != "":
+		calendar, ok := seasonCalendars[season]
+		if !ok {
+			return nil, errors.New("unknown season parameter: " + season + ", the supported seasons are " + strings.Join(supportedSeasons(), ", "))
+		}
+		return expandDateRange(calendar.start, calendar.end)
+	default:
+		return nil, errors.New("specify at most one of --date, --start-date and --end-date, or --season")
+	}
+}
+
+/* Accepts a YYYY-MM-DD date, 'today', 'yesterday', or an offset from today such as 'today-2' */
+func resolveDateExpression(expression string, now time.Time) (string, error) {
+	expression = strings.ToLower(strings.TrimSpace(expression))
+	today := gameDateToday(now)
+
+	switch {
+	case expression == "today":
+		return today.Format(dateLayout), nil
+	case expression == "yesterday":
+		return today.AddDate(0, 0, -1).Format(dateLayout), nil
+	case strings.HasPrefix(expression, "today-") || strings.HasPrefix(expression, "today+"):
+		offset, err := strconv.Atoi(expression[len("today"):])
+		if err != nil {
+			return "", errors.New("invalid relative date expression: " + expression)
+		}
+		return today.AddDate(0, 0, offset).Format(dateLayout), nil
+	default:
+		if _, err := time.Parse(dateLayout, expression); err != nil {
+			return "", errors.New("error processing date parameter: " + expression)
+		}
+		return expression, nil
+	}
+}
+
+/* With the deprecated --process flag, --date was the run date and the game date was lag days before it */
+func legacyGameDate(runDate string, lagDays int, now time.Time) (string, error) {
+	if lagDays < 0 {
+		return "", errors.New("lag days must not be negative")
+	}
+	date, err := resolveDateExpression(runDate, now)
+	if err != nil {
+		return "", err
+	}
+	gameDate, _ := time.Parse(dateLayout, date)
+	return gameDate.AddDate(0, 0, -lagDays).Format(dateLayout), nil
+}
+
+/* Game dates follow the league's schedule, so 'today' is the current date in Eastern time */
+func gameDateToday(now time.Time) time.Time {
+	if loc, err := time.LoadLocation(timezoneEstName); err == nil {
+		now = now.In(loc)
+	}
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func expandDateRange(startDate string, endDate string) (dates []string, err error) {
+	start, err1 := time.Parse(dateLayout, startDate)
+	end, err2 := time.Parse(dateLayout, endDate)
+	if err1 != nil || err2 != nil {
+		return nil, errors.New("error processing date range parameters")
+	}
+	if end.Before(start) {
+		return nil, errors.New("end date must not be before start date")
+	}
+
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		dates = append(dates, day.Format(dateLayout))
+	}
+	return dates, nil
+}
+
+func describeDates(dates []string) string {
+	if len(dates) == 1 {
+		return dates[0]
+	}
+	return dates[0] + " to " + dates[len(dates)-1] + " (" + strconv.Itoa(len(dates)) + " dates)"
+}
+
+/* Dates of a season, formatted 2006-01-02, see seasonCalendars */
+type seasonCalendar struct {
+	start        string
+	playInStart  string
+	playoffStart string
+	end          string
+}
+
+/*
+Returns the starting year of the season the date falls in, by its calendar since seasons don't always start
+and end in the same months, ex. 2020-21. Dates between two seasons return no season, dates outside every
+supported season an error
+*/
+func seasonOfDate(date string) (string, seasonCalendar, error) {
+	seasons := supportedSeasons()
+	if date < seasonCalendars[seasons[0]].start || date > seasonCalendars[seasons[len(seasons)-1]].end {
+		return "", seasonCalendar{}, errors.New("game date " + date + " falls outside the supported seasons " + strings.Join(seasons, ", "))
+	}
+	for _, season := range seasons {
+		if calendar := seasonCalendars[season]; date >= calendar.start && date <= calendar.end {
+			return season, calendar, nil
+		}
+	}
+	return "", seasonCalendar{}, nil
+}
+
+func supportedSeasons() []string {
+	seasons := make([]string, 0, len(seasonCalendars))
+	for season := range seasonCalendars {
+		seasons = append(seasons, season)
+	}
+	slices.Sort(seasons)
+	return seasons
+}
@@ -0,0 +1,37 @@
+package helpers
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestResolveRunDatesLagDays(t *testing.T) {
+	now := time.Date(2024, 10, 24, 12, 0, 0, 0, time.UTC)
+
+	if dates, err := resolveRunDates("", "", "", "", 1, true, now); err != nil || !slices.Equal(dates, []string{"2024-10-23"}) {
+		t.Errorf("expected the lag to apply without a date, got %v, %v", dates, err)
+	}
+	if dates, err := resolveRunDates("yesterday", "", "", "", defaultLagDays, false, now); err != nil || !slices.Equal(dates, []string{"2024-10-23"}) {
+		t.Errorf("expected the default lag to leave an explicit date alone, got %v, %v", dates, err)
+	}
+	if _, err := resolveRunDates("yesterday", "", "", "", 1, true, now); err == nil {
+		t.Error("expected an error for --lag-days with --date")
+	}
+	if _, err := resolveRunDates("", "2024-10-22", "2024-10-23", "", 1, true, now); err == nil {
+		t.Error("expected an error for --lag-days with a date range")
+	}
+	if _, err := resolveRunDates("", "", "", "2024", 1, true, now); err == nil {
+		t.Error("expected an error for --lag-days with --season")
+	}
+	if _, err := resolveRunDates("2024-10-22", "", "", "", -1, false, now); err == nil {
+		t.Error("expected an error for negative lag days")
+	}
+
+	if date, err := legacyGameDate("2024-10-24", 2, now); err != nil || date != "2024-10-22" {
+		t.Errorf("expected the legacy game date lag days before the run date, got %s, %v", date, err)
+	}
+	if _, err := legacyGameDate("2024-10-24", -1, now); err == nil {
+		t.Error("expected an error for negative lag days with --process")
+	}
+}
@@ -0,0 +1,138 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/* Funcs for reporting planned writes when running with --dry-run */
+type fieldDiff struct {
+	path     string
+	oldValue interface{}
+	newValue interface{}
+}
+
+func planUpserts(ctx context.Context, collectionName string, writes []plannedWrite) error {
+	logger := loggerFrom(ctx).With("collection", collectionName)
+	var numInserts, numUpdates, numUnchanged int
+	for _, write := range writes {
+		if write.existingDoc == nil {
+			numInserts += 1
+			logger.Info("Dry run: would insert document", "filter", fmt.Sprint(write.filter))
+			continue
+		}
+
+		newDoc, err := toBsonMap(write.newDoc)
+		if err != nil {
+			return err
+		}
+		diffs := diffDocuments("", write.existingDoc, newDoc)
+		if len(diffs) == 0 {
+			numUnchanged += 1
+			continue
+		}
+		numUpdates += 1
+		for _, diff := range diffs {
+			logger.Info("Dry run: would update document field", "filter", fmt.Sprint(write.filter),
+				"field", diff.path, "old", fmt.Sprint(diff.oldValue), "new", fmt.Sprint(diff.newValue))
+		}
+	}
+	logger.Info("Dry run: planned collection writes", "inserts", numInserts, "updates", numUpdates, "unchanged", numUnchanged)
+	stageReportFrom(ctx).recordCollectionWrites(collectionName, int64(numUpdates+numUnchanged), int64(numUpdates), int64(numInserts))
+	return nil
+}
+
+func logCsvRowDiff(ctx context.Context, csvName string, key string, header []string, oldRow []string, newRow []string) bool {
+	var diffs []fieldDiff
+	for i := 0; i < len(oldRow) || i < len(newRow); i++ {
+		oldValue, newValue := valueAt(oldRow, i), valueAt(newRow, i)
+		if oldValue != newValue {
+			diffs = append(diffs, fieldDiff{path: valueAtOrIndex(header, i), oldValue: oldValue, newValue: newValue})
+		}
+	}
+	if len(diffs) == 0 {
+		return false
+	}
+
+	for _, diff := range diffs {
+		loggerFrom(ctx).Info("Dry run: would update csv field", "csv", csvName, "key", key,
+			"field", diff.path, "old", fmt.Sprint(diff.oldValue), "new", fmt.Sprint(diff.newValue))
+	}
+	return true
+}
+
+/* Only fields being set are compared, since $set leaves every other field in place */
+func diffDocuments(prefix string, oldValue interface{}, newValue interface{}) (diffs []fieldDiff) {
+	switch newTyped := newValue.(type) {
+	case bson.M:
+		oldTyped, ok := oldValue.(bson.M)
+		if !ok {
+			return []fieldDiff{{prefix, oldValue, newValue}}
+		}
+		keys := make([]string, 0, len(newTyped))
+		for key := range newTyped {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			diffs = append(diffs, diffDocuments(joinPath(prefix, key), oldTyped[key], newTyped[key])...)
+		}
+	case primitive.A:
+		oldTyped, ok := oldValue.(primitive.A)
+		if !ok {
+			return []fieldDiff{{prefix, oldValue, newValue}}
+		}
+		for i := 0; i < len(oldTyped) || i < len(newTyped); i++ {
+			path := joinPath(prefix, strconv.Itoa(i))
+			if i >= len(newTyped) {
+				diffs = append(diffs, fieldDiff{path, oldTyped[i], nil})
+			} else if i >= len(oldTyped) {
+				diffs = append(diffs, fieldDiff{path, nil, newTyped[i]})
+			} else {
+				diffs = append(diffs, diffDocuments(path, oldTyped[i], newTyped[i])...)
+			}
+		}
+	default:
+		if !reflect.DeepEqual(oldValue, newValue) {
+			diffs = append(diffs, fieldDiff{prefix, oldValue, newValue})
+		}
+	}
+	return diffs
+}
+
+func toBsonMap(value interface{}) (bson.M, error) {
+	bytes, err := bson.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.M
+	err = bson.Unmarshal(bytes, &doc)
+	return doc, err
+}
+
+func joinPath(prefix string, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func valueAt(row []string, i int) string {
+	if i < len(row) {
+		return row[i]
+	}
+	return ""
+}
+
+func valueAtOrIndex(row []string, i int) string {
+	if i < len(row) {
+		return row[i]
+	}
+	return "column " + strconv.Itoa(i)
+}
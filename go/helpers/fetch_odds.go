@@ -3,70 +3,64 @@ package helpers
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"strconv"
-
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
+	"strings"
 )
 
-func FetchOdds(date string) (err error) {
-	client, err := loadMongoDbClient(*Config)
+func FetchOdds(ctx context.Context, store Store, date string) (err error) {
+	fetchedOdds, err := runWorkerPool(ctx, Workers, Config.Odds.SnapshotUtcHours, func(ctx context.Context, utcHour int) (*RawOddsResponse, error) {
+		existingData, err := store.FindRawOdds(ctx, date, utcHour)
+		if err == nil && existingData == nil {
+			return fetchOdds(ctx, date, utcHour)
+		}
+		return nil, err
+	})
 	if err != nil {
-		return
+		return err
 	}
-	defer func() {
-		if err4 := closeMongoDBConnection(client, err); err4 != nil {
-			err = err4
-		}
-	}()
-	rawOddsCollection := getHistoricalOddscollection(client, Config.Database.Schema)
 
-	var existingData RawOddsResponse
 	var oddsResponses []RawOddsResponse
-	var rawOdds *RawOddsResponse
-	for _, val := range utcHoursForLookup {
-		err = rawOddsCollection.FindOne(context.TODO(), rawOddsDbFilter(date, val)).Decode(&existingData)
-		if err == mongo.ErrNoDocuments {
-			rawOdds, err = fetchOdds(date, val)
+	for _, rawOdds := range fetchedOdds {
+		if rawOdds != nil {
 			oddsResponses = append(oddsResponses, *rawOdds)
 		}
-		if err != nil {
-			return err
-		}
 	}
-	Logger.Printf("Fetched %d new odds responses from source", len(oddsResponses))
-	_, err = upsertRawOddsRows(oddsResponses, rawOddsCollection)
-	return err
+	loggerFrom(ctx).Info("Fetched new odds responses from source", "count", len(oddsResponses))
+	stageReportFrom(ctx).recordOddsSnapshots(len(oddsResponses))
+	return store.UpsertRawOdds(ctx, oddsResponses)
 }
 
-func fetchOdds(date string, utcHour int) (oddsResponse *RawOddsResponse, err error) {
+func fetchOdds(ctx context.Context, date string, utcHour int) (oddsResponse *RawOddsResponse, err error) {
 	urlString := buildOddsSourceUrl(date, strconv.Itoa(utcHour))
-	response, err1 := http.Get(urlString)
-	responseData, err2 := io.ReadAll(response.Body)
-	err3 := json.Unmarshal(responseData, &oddsResponse)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, urlString, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := http.DefaultClient.Do(request)
+	recordOddsApiResponse(response)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
 
-	if err1 != nil || err2 != nil || err3 != nil {
-		return nil, handleMultipleErrors(err1, err2, err3)
+	/* Errors, ex. a 401 for a bad key or a 429 past the quota, would otherwise be stored as the snapshot and never fetched again */
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return nil, fmt.Errorf("odds API returned %s for the %s %02d:00 UTC snapshot: %s", response.Status, date, utcHour, strings.TrimSpace(string(body)))
+	}
+	responseData, err1 := io.ReadAll(response.Body)
+	err2 := json.Unmarshal(responseData, &oddsResponse)
+	if err1 != nil || err2 != nil {
+		return nil, handleMultipleErrors(err1, err2)
 	}
 	oddsResponse.Date = date
 	oddsResponse.UtcHour = utcHour
 	return oddsResponse, nil
 }
 
-func upsertRawOddsRows(oddsResponse []RawOddsResponse, dbCollection *mongo.Collection) (*mongo.BulkWriteResult, error) {
-	var operations = make([]mongo.WriteModel, 0, len(oddsResponse))
-	for _, doc := range oddsResponse {
-		operations = append(operations, mongo.NewUpdateOneModel().
-			SetFilter(rawOddsDbFilter(doc.Date, doc.UtcHour)).
-			SetUpdate(bson.M{"$set": doc}).
-			SetUpsert(true))
-	}
-	return upsertItemsGeneric(operations, dbCollection)
-}
-
-// TODO: Hide this from git
 func buildOddsSourceUrl(date string, utcHour string) string {
-	return Config.OddsApi.BaseUrl + oddsSourceApiPath + "?apiKey=" + Config.OddsApi.Key + "&markets=spreads,totals,h2h&regions=us&date=" + date + "T" + utcHour + ":00:00Z"
+	return Config.OddsApi.BaseUrl + Config.OddsApi.HistoricalOddsPath + "?apiKey=" + Config.OddsApi.Key + "&markets=spreads,totals,h2h&regions=us&date=" + date + "T" + utcHour + ":00:00Z"
 }
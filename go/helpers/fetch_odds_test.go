@@ -0,0 +1,46 @@
+package helpers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFetchOddsStoresOnlySuccessfulResponses(t *testing.T) {
+	cfg := useTestConfig(t)
+	var status atomic.Int32
+	status.Store(http.StatusTooManyRequests)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(status.Load()))
+		if status.Load() == http.StatusOK {
+			w.Write([]byte(`{"timestamp": "2024-10-22T23:00:00Z", "data": []}`))
+		} else {
+			w.Write([]byte(`{"message": "Usage quota has been reached"}`))
+		}
+	}))
+	defer server.Close()
+	cfg.OddsApi.BaseUrl = server.URL
+	cfg.Odds.SnapshotUtcHours = []int{23}
+	store, err := newStore(*cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err = FetchOdds(ctx, store, "2024-10-22"); err == nil {
+		t.Error("expected a 429 from the odds API to fail the fetch")
+	}
+	if exists, err := rawOddsExist(ctx, store, "2024-10-22"); err != nil || exists {
+		t.Fatalf("expected the 429 body not to be stored as the snapshot, got %v, %v", exists, err)
+	}
+
+	status.Store(http.StatusOK)
+	if err = FetchOdds(ctx, store, "2024-10-22"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := rawOddsExist(ctx, store, "2024-10-22"); err != nil || !exists {
+		t.Errorf("expected the snapshot to be stored once the odds API succeeds, got %v, %v", exists, err)
+	}
+}
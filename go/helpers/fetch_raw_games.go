@@ -0,0 +1,206 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+func FetchGames(ctx context.Context, store Store, date string) (err error) {
+	season, seasonType, seasonId, err := seasonForGameDate(date)
+	if err != nil {
+		return err
+	}
+	if season == "" {
+		loggerFrom(ctx).Info("Found no season on the game date, skipping the offseason date")
+		return nil
+	}
+	teamMetadata, err := store.FindTeamMetadata(ctx)
+	if err != nil {
+		return err
+	}
+	loggerFrom(ctx).Info("Looking up games in team game logs", "season", season, "seasonType", seasonType)
+
+	statsClient := newStatsApiClient(Config.StatsApi)
+	teamGameLogs, err := runWorkerPool(ctx, Workers, teamMetadata, func(ctx context.Context, team TeamMetadata) ([]GameLogEntry, error) {
+		return fetchTeamGameLog(ctx, statsClient, team.TeamId, date, season, seasonType)
+	})
+	if err != nil {
+		return err
+	}
+	games := uniqueGameLogEntries(teamGameLogs)
+	loggerFrom(ctx).Info("Found games in team game logs", "count", len(games))
+	stageReportFrom(ctx).recordGamesFound(len(games))
+
+	newGames, err := filterNewGames(ctx, games, store)
+	if err != nil {
+		return err
+	}
+	loggerFrom(ctx).Info("Fetching play by play of new games", "existing", len(games)-len(newGames), "new", len(newGames))
+
+	rawGames, failures, err := processGames(ctx, FetchRawGames, date, newGames, gameLogEntryId, func(ctx context.Context, game GameLogEntry) (RawNbaGame, error) {
+		return fetchRawGame(ctx, statsClient, game, seasonId)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = store.UpsertRawGames(ctx, rawGames); err != nil {
+		return err
+	}
+	return recordProcessingErrors(ctx, store, FetchRawGames, failures, rawGameIds(rawGames))
+}
+
+func fetchTeamGameLog(ctx context.Context, statsClient *statsApiClient, teamId int, date string, season string, seasonType string) ([]GameLogEntry, error) {
+	gameDate, err := time.Parse(dateLayout, date)
+	if err != nil {
+		return nil, err
+	}
+	response, err := statsClient.get(ctx, teamGameLogEndpoint, url.Values{
+		"TeamID":     {strconv.Itoa(teamId)},
+		"Season":     {season},
+		"SeasonType": {seasonType},
+		"LeagueID":   {"00"},
+		"DateFrom":   {gameDate.Format(statsApiDateLayout)},
+		"DateTo":     {gameDate.Format(statsApiDateLayout)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	gameLog, err := response.resultSet("TeamGameLog")
+	if err != nil {
+		return nil, err
+	}
+	gameIdIndex, err1 := gameLog.columnIndex("Game_ID")
+	dateIndex, err2 := gameLog.columnIndex("GAME_DATE")
+	matchupIndex, err3 := gameLog.columnIndex("MATCHUP")
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil, handleMultipleErrors(err1, err2, err3)
+	}
+
+	var entries []GameLogEntry
+	for _, row := range gameLog.RowSet {
+		gameId, ok1 := row[gameIdIndex].(string)
+		rawDate, ok2 := row[dateIndex].(string)
+		matchup, ok3 := row[matchupIndex].(string)
+		if !ok1 || !ok2 || !ok3 {
+			return nil, errors.New("error parsing team game log row")
+		}
+
+		/* Game log dates look like 'OCT 22, 2024' */
+		rowDate, err := time.Parse("Jan 02, 2006", rawDate)
+		if err != nil {
+			return nil, errors.New("error parsing team game log date: " + rawDate)
+		}
+		if rowDate.Format(dateLayout) == date {
+			entries = append(entries, GameLogEntry{GameId: gameId, Date: date, Matchup: matchup})
+		}
+	}
+	return entries, nil
+}
+
+func fetchRawGame(ctx context.Context, statsClient *statsApiClient, game GameLogEntry, seasonId string) (RawNbaGame, error) {
+	response, err := statsClient.get(ctx, playByPlayEndpoint, url.Values{
+		"GameID":      {game.GameId},
+		"StartPeriod": {"1"},
+		"EndPeriod":   {"10"},
+	})
+	if err != nil {
+		return RawNbaGame{}, err
+	}
+
+	playByPlay, err := response.resultSet("PlayByPlay")
+	if err != nil {
+		return RawNbaGame{}, err
+	}
+	if len(playByPlay.RowSet) == 0 {
+		return RawNbaGame{}, errors.New("found no play by play rows for game " + game.GameId)
+	}
+
+	parameters := response.Parameters
+	parameters.GameId = ternaryOperator(parameters.GameId == "", game.GameId, parameters.GameId)
+	return RawNbaGame{
+		Resource:       response.Resource,
+		Parameters:     parameters,
+		PlayByPlayRows: rowsToBson(playByPlay.RowSet),
+		GameId:         game.GameId,
+		Date:           game.Date,
+		Matchup:        game.Matchup,
+		SeasonId:       seasonId,
+	}, nil
+}
+
+/* Both teams' game logs list every game. The first matchup found is kept, either format can be cleaned */
+func uniqueGameLogEntries(teamGameLogs [][]GameLogEntry) (games []GameLogEntry) {
+	seen := make(map[string]bool)
+	for _, gameLog := range teamGameLogs {
+		for _, entry := range gameLog {
+			if !seen[entry.GameId] {
+				seen[entry.GameId] = true
+				games = append(games, entry)
+			}
+		}
+	}
+	return games
+}
+
+/* Play by play is only fetched once per game, as it no longer changes once the game is in the game logs */
+func filterNewGames(ctx context.Context, games []GameLogEntry, store Store) (newGames []GameLogEntry, err error) {
+	gameIds := make([]string, 0, len(games))
+	for _, game := range games {
+		gameIds = append(gameIds, game.GameId)
+	}
+	existingIds, err := store.FindExistingRawGameIds(ctx, gameIds)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]bool, len(existingIds))
+	for _, gameId := range existingIds {
+		existing[gameId] = true
+	}
+	for _, game := range games {
+		if !existing[game.GameId] {
+			newGames = append(newGames, game)
+		}
+	}
+	return newGames, nil
+}
+
+/* Returns the stats API season, ex. 2024-25, the season type, and the season id, ex. 22024 for the regular season, 52024 for the play-in tournament and 42024 for the playoffs. The season is empty in the offseason */
+func seasonForGameDate(date string) (season string, seasonType string, seasonId string, err error) {
+	if _, err = time.Parse(dateLayout, date); err != nil {
+		return "", "", "", errors.New("error processing date parameter: " + date)
+	}
+	seasonKey, calendar, err := seasonOfDate(date)
+	if err != nil || seasonKey == "" {
+		return "", "", "", err
+	}
+
+	startYear, _ := strconv.Atoi(seasonKey)
+	season = fmt.Sprintf("%d-%02d", startYear, (startYear+1)%100)
+	switch {
+	case date >= calendar.playoffStart:
+		return season, "Playoffs", "4" + seasonKey, nil
+	case calendar.playInStart != "" && date >= calendar.playInStart:
+		return season, "PlayIn", "5" + seasonKey, nil
+	default:
+		return season, "Regular Season", "2" + seasonKey, nil
+	}
+}
+
+func gameLogEntryId(game GameLogEntry) string {
+	return game.GameId
+}
+
+func rawGameIds(games []RawNbaGame) []string {
+	var gameIds = make([]string, 0, len(games))
+	for _, game := range games {
+		gameIds = append(gameIds, game.GameId)
+	}
+	return gameIds
+}
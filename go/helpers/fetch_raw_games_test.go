@@ -0,0 +1,37 @@
+package helpers
+
+import "testing"
+
+func TestSeasonForGameDate(t *testing.T) {
+	tests := []struct {
+		date       string
+		season     string
+		seasonType string
+		seasonId   string
+	}{
+		{"2024-10-22", "2024-25", "Regular Season", "22024"},
+		{"2025-04-13", "2024-25", "Regular Season", "22024"},
+		{"2025-04-15", "2024-25", "PlayIn", "52024"},
+		{"2025-04-18", "2024-25", "PlayIn", "52024"},
+		{"2025-04-19", "2024-25", "Playoffs", "42024"},
+		{"2020-08-15", "2019-20", "PlayIn", "52019"},
+		{"2019-04-13", "2018-19", "Playoffs", "42018"},
+		{"2021-01-05", "2020-21", "Regular Season", "22020"},
+		{"2024-08-01", "", "", ""},
+	}
+	for _, test := range tests {
+		season, seasonType, seasonId, err := seasonForGameDate(test.date)
+		if err != nil {
+			t.Fatalf("%s: %v", test.date, err)
+		}
+		if season != test.season || seasonType != test.seasonType || seasonId != test.seasonId {
+			t.Errorf("%s: got %s %s %s, want %s %s %s", test.date, season, seasonType, seasonId, test.season, test.seasonType, test.seasonId)
+		}
+	}
+
+	for _, date := range []string{"2015-10-01", "2025-10-21", "2024-13-01"} {
+		if _, _, _, err := seasonForGameDate(date); err == nil {
+			t.Errorf("%s: expected an error outside the supported seasons", date)
+		}
+	}
+}
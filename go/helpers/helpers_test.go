@@ -0,0 +1,33 @@
+package helpers
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+/* The processes log through the global logger, which Setup creates for the binary */
+func TestMain(m *testing.M) {
+	Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	os.Exit(m.Run())
+}
+
+/* Sets the global config to the defaults on the memory store, writing its files under a temp directory */
+func useTestConfig(t *testing.T) *NbaConfig {
+	t.Helper()
+	directory := t.TempDir()
+	cfg := &NbaConfig{}
+	presetConfigDefaults(cfg)
+	cfg.Database.Backend = "memory"
+	cfg.Csv.Directory = filepath.Join(directory, "csvs")
+	cfg.Csv.ParquetDirectory = filepath.Join(directory, "parquet")
+	cfg.Report.Directory = filepath.Join(directory, "reports")
+	applyConfigDefaults(cfg)
+
+	previous := Config
+	Config = cfg
+	t.Cleanup(func() { Config = previous })
+	return cfg
+}
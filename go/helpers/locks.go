@@ -0,0 +1,269 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+/*
+Locks keeping two processes, ex. an airflow retry and a manual run, from running the same stage of a
+date at once. Every stage takes a lease in the store, and the stages writing the csvs also take a lock
+file in the csv directory, since every date shares the month partitions. Leases are renewed while the
+stage runs, and a lease that can't be renewed cancels the stage
+*/
+var ErrLockHeld = errors.New("lock held by another process")
+var ErrLockLost = errors.New("lock lost")
+
+type lease interface {
+	acquire(ctx context.Context) error
+	renew(ctx context.Context) error
+	release(ctx context.Context) error
+	forceRelease(ctx context.Context) error
+	describe() string
+}
+
+/* Lease on a stage of a date, kept in the store */
+type storeLease struct {
+	store Store
+	lock  PipelineLock
+}
+
+/* Lease on the csv directory, kept in a lock file beside the csvs */
+type csvLockFile struct {
+	lock PipelineLock
+}
+
+func newPipelineLock(lockId string, stage ProcessType, date string, runId string) PipelineLock {
+	host, _ := os.Hostname()
+	now := time.Now().UTC()
+	return PipelineLock{
+		LockId:     lockId,
+		Stage:      string(stage),
+		GameDate:   date,
+		RunId:      runId,
+		Host:       host,
+		Pid:        os.Getpid(),
+		AcquiredAt: now,
+		ExpiresAt:  now.Add(lockLeaseDuration),
+	}
+}
+
+func stageLeases(store Store, stage ProcessType, date string, runId string) []lease {
+	leases := []lease{&storeLease{store, newPipelineLock(string(stage)+"/"+date, stage, date, runId)}}
+	if stage == CombineGameWithOdds {
+		leases = append(leases, &csvLockFile{newPipelineLock(Config.Csv.Directory, stage, date, runId)})
+	}
+	return leases
+}
+
+/* Dry runs write nothing, so they run without locks */
+func withLeases(ctx context.Context, leases []lease, run func(ctx context.Context) error) (err error) {
+	if DryRun {
+		return run(ctx)
+	}
+
+	for i, l := range leases {
+		if ForceUnlock {
+			loggerFrom(ctx).Warn("Force unlocking", "lock", l.describe())
+			if err = l.forceRelease(ctx); err != nil {
+				releaseLeases(ctx, leases[:i])
+				return err
+			}
+		}
+		if err = l.acquire(ctx); err != nil {
+			releaseLeases(ctx, leases[:i])
+			return err
+		}
+		loggerFrom(ctx).Debug("Acquired lock", "lock", l.describe())
+	}
+	defer releaseLeases(ctx, leases)
+
+	runCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		renewLeases(runCtx, leases, cancel, done)
+		close(stopped)
+	}()
+
+	err = run(runCtx)
+	close(done)
+	<-stopped
+	if cause := context.Cause(runCtx); err == nil && errors.Is(cause, ErrLockLost) {
+		return cause
+	}
+	return err
+}
+
+func renewLeases(ctx context.Context, leases []lease, cancel context.CancelCauseFunc, done <-chan struct{}) {
+	ticker := time.NewTicker(lockRenewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			for _, l := range leases {
+				if err := l.renew(ctx); err != nil {
+					loggerFrom(ctx).Error("Failed renewing lock, cancelling the stage", "lock", l.describe(), "error", err)
+					cancel(fmt.Errorf("%w: %s: %v", ErrLockLost, l.describe(), err))
+					return
+				}
+			}
+		}
+	}
+}
+
+/* Context is detached, so a cancelled stage still releases its locks */
+func releaseLeases(ctx context.Context, leases []lease) {
+	for _, l := range leases {
+		if err := l.release(context.WithoutCancel(ctx)); err != nil {
+			loggerFrom(ctx).Warn("Failed releasing lock", "lock", l.describe(), "error", err)
+		}
+	}
+}
+
+func lockHeldError(holder PipelineLock) error {
+	return fmt.Errorf("%w: %s is locked by run %s on %s (pid %d) since %s, until %s. Rerun with --force-unlock if that process is gone",
+		ErrLockHeld, holder.LockId, holder.RunId, holder.Host, holder.Pid,
+		holder.AcquiredAt.Format(time.RFC3339), holder.ExpiresAt.Format(time.RFC3339))
+}
+
+/* A lock can be taken when it is free, expired, or already held by the same process */
+func lockAvailable(existing *PipelineLock, lock PipelineLock) bool {
+	return existing == nil || !existing.ExpiresAt.After(time.Now()) || sameLockOwner(*existing, lock)
+}
+
+func sameLockOwner(a PipelineLock, b PipelineLock) bool {
+	return a.RunId == b.RunId && a.Host == b.Host && a.Pid == b.Pid
+}
+
+func renewedLock(lock PipelineLock) PipelineLock {
+	lock.ExpiresAt = time.Now().UTC().Add(lockLeaseDuration)
+	return lock
+}
+
+func (l *storeLease) acquire(ctx context.Context) error {
+	return l.store.AcquireLock(ctx, l.lock)
+}
+
+func (l *storeLease) renew(ctx context.Context) error {
+	l.lock = renewedLock(l.lock)
+	return l.store.RenewLock(ctx, l.lock)
+}
+
+func (l *storeLease) release(ctx context.Context) error {
+	return l.store.ReleaseLock(ctx, l.lock)
+}
+
+func (l *storeLease) forceRelease(ctx context.Context) error {
+	return l.store.DeleteLock(ctx, l.lock.LockId)
+}
+
+func (l *storeLease) describe() string {
+	return l.lock.LockId
+}
+
+func (l *csvLockFile) path() string {
+	return filepath.Join(Config.Csv.Directory, csvLockFileName)
+}
+
+/* An expired lock file is removed and created again */
+func (l *csvLockFile) acquire(ctx context.Context) error {
+	if err := os.MkdirAll(Config.Csv.Directory, 0755); err != nil {
+		return err
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		err := l.create()
+		if err == nil || !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+
+		holder, err := l.read()
+		if err != nil {
+			return err
+		}
+		if !lockAvailable(holder, l.lock) {
+			return lockHeldError(*holder)
+		}
+		if holder != nil {
+			loggerFrom(ctx).Warn("Taking over expired lock file", "path", l.path(), "runId", holder.RunId, "expiresAt", holder.ExpiresAt)
+		}
+		if err = os.Remove(l.path()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return fmt.Errorf("%w: %s was recreated by another process", ErrLockHeld, l.path())
+}
+
+/* Written to a temp file and hard linked, which fails when the lock file exists, so it is never seen half written */
+func (l *csvLockFile) create() error {
+	tempPath := l.path() + "." + strconv.Itoa(os.Getpid()) + ".tmp"
+	err := writeFileAtomically(tempPath, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(l.lock)
+	})
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempPath)
+	return os.Link(tempPath, l.path())
+}
+
+/* Rewritten through a rename, so a lock file removed while it is renewed can come back */
+func (l *csvLockFile) renew(ctx context.Context) error {
+	holder, err := l.read()
+	if err != nil {
+		return err
+	}
+	if holder == nil || !sameLockOwner(*holder, l.lock) {
+		return fmt.Errorf("%w: %s was removed or taken over", ErrLockLost, l.path())
+	}
+	l.lock = renewedLock(l.lock)
+	return writeFileAtomically(l.path(), func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(l.lock)
+	})
+}
+
+func (l *csvLockFile) release(ctx context.Context) error {
+	holder, err := l.read()
+	if err != nil || holder == nil || !sameLockOwner(*holder, l.lock) {
+		return err
+	}
+	return os.Remove(l.path())
+}
+
+func (l *csvLockFile) forceRelease(ctx context.Context) error {
+	if err := os.Remove(l.path()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *csvLockFile) describe() string {
+	return l.path()
+}
+
+/* Returns nil when there is no lock file */
+func (l *csvLockFile) read() (*PipelineLock, error) {
+	contents, err := os.ReadFile(l.path())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var holder PipelineLock
+	if err = json.Unmarshal(contents, &holder); err != nil {
+		return nil, fmt.Errorf("unreadable lock file %s, remove it or rerun with --force-unlock: %w", l.path(), err)
+	}
+	return &holder, nil
+}
@@ -0,0 +1,74 @@
+package helpers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+/*
+Structured, leveled logging. Every line carries the run id and process name, and the loggers
+handed down through the context add the game date and game id where relevant
+*/
+type loggerContextKey struct{}
+
+/* Lines are written to the log file and to console, stdout or stderr */
+func initializeLogger(cfg LoggingConfig, runId string, process ProcessType, console io.Writer) (io.Closer, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, errors.New("invalid log level: " + cfg.Level)
+	}
+
+	file, err := newRotatingFile(cfg.Path, cfg.MaxSizeMb, cfg.MaxBackups)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing logger at %s: %w", cfg.Path, err)
+	}
+
+	multiWriter := io.MultiWriter(console, file)
+	handlerOptions := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "json":
+		handler = slog.NewJSONHandler(multiWriter, handlerOptions)
+	case "logfmt":
+		handler = slog.NewTextHandler(multiWriter, handlerOptions)
+	default:
+		file.Close()
+		return nil, errors.New("invalid log format, expected json or logfmt: " + cfg.Format)
+	}
+
+	Logger = slog.New(handler).With("runId", runId, "process", string(process))
+	return file, nil
+}
+
+func withLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return Logger
+}
+
+func withGameDate(ctx context.Context, date string) context.Context {
+	return withLogger(ctx, loggerFrom(ctx).With("gameDate", date))
+}
+
+func withGameId(ctx context.Context, gameId string) context.Context {
+	return withLogger(ctx, loggerFrom(ctx).With("gameId", gameId))
+}
+
+func newRunId() string {
+	bytes := make([]byte, 8)
+	if _, err := rand.Read(bytes); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(bytes)
+}
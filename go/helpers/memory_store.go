@@ -0,0 +1,371 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+/*
+Store kept in process memory, for running the processes offline and in tests. Documents are
+copied through bson on the way in, so they read back with the same types as from MongoDB
+*/
+type memoryStore struct {
+	mu               sync.Mutex
+	teamMetadata     *memoryCollection[TeamMetadata]
+	rawGames         *memoryCollection[RawNbaGame]
+	rawOdds          *memoryCollection[RawOddsResponse]
+	cleanedGames     *memoryCollection[CleanedGame]
+	cleanedOdds      *memoryCollection[CleanedOdds]
+	processingErrors *memoryCollection[ProcessingError]
+	pipelineRuns     *memoryCollection[PipelineRun]
+	pipelineLocks    *memoryCollection[PipelineLock]
+}
+
+/* Documents of one collection by their upsert filter, kept in insertion order like a natural order find */
+type memoryCollection[T any] struct {
+	name   string
+	filter func(T) bson.M
+	keys   []string
+	docs   map[string]T
+}
+
+/* The seed directory is optional. Files are named after their collection, ex. teamMetadata.json */
+func newMemoryStore(seedDirectory string) (*memoryStore, error) {
+	store := &memoryStore{
+		teamMetadata: newMemoryCollection(Config.Collections.TeamMetadata, func(team TeamMetadata) bson.M {
+			return bson.M{"teamId": team.TeamId}
+		}),
+		rawGames: newMemoryCollection(Config.Collections.RawGames, func(game RawNbaGame) bson.M {
+			return gameIdFilter(game.GameId)
+		}),
+		rawOdds: newMemoryCollection(Config.Collections.RawOdds, func(odds RawOddsResponse) bson.M {
+			return rawOddsDbFilter(odds.Date, odds.UtcHour)
+		}),
+		cleanedGames: newMemoryCollection(Config.Collections.CleanedGames, func(game CleanedGame) bson.M {
+			return gameIdFilter(game.GameId)
+		}),
+		cleanedOdds: newMemoryCollection(Config.Collections.CleanedOdds, func(odds CleanedOdds) bson.M {
+			return gameIdFilter(odds.GameId)
+		}),
+		processingErrors: newMemoryCollection(Config.Collections.ProcessingErrors, func(failure ProcessingError) bson.M {
+			return processingErrorFilter(failure.GameId, ProcessType(failure.Process))
+		}),
+		pipelineRuns: newMemoryCollection(Config.Collections.PipelineRuns, func(run PipelineRun) bson.M {
+			return pipelineRunFilter(run.RunId, run.GameDate, run.Stage)
+		}),
+		pipelineLocks: newMemoryCollection(Config.Collections.PipelineLocks, func(lock PipelineLock) bson.M {
+			return bson.M{"_id": lock.LockId}
+		}),
+	}
+	if seedDirectory == "" {
+		return store, nil
+	}
+
+	err1 := seedMemoryCollection(seedDirectory, store.teamMetadata)
+	err2 := seedMemoryCollection(seedDirectory, store.rawGames)
+	err3 := seedMemoryCollection(seedDirectory, store.rawOdds)
+	err4 := seedMemoryCollection(seedDirectory, store.cleanedGames)
+	err5 := seedMemoryCollection(seedDirectory, store.cleanedOdds)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || err5 != nil {
+		return nil, handleMultipleErrors(err1, err2, err3, err4, err5)
+	}
+	return store, nil
+}
+
+func (store *memoryStore) Close(ctx context.Context) error {
+	return nil
+}
+
+func (store *memoryStore) FindTeamMetadata(ctx context.Context) ([]TeamMetadata, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.teamMetadata.find(func(TeamMetadata) bool { return true }), nil
+}
+
+func (store *memoryStore) FindRawGames(ctx context.Context, date string) ([]RawNbaGame, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.rawGames.find(func(game RawNbaGame) bool { return game.Date == date }), nil
+}
+
+func (store *memoryStore) FindExistingRawGameIds(ctx context.Context, gameIds []string) ([]string, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	var existingIds []string
+	for _, game := range store.rawGames.find(func(game RawNbaGame) bool { return slices.Contains(gameIds, game.GameId) }) {
+		existingIds = append(existingIds, game.GameId)
+	}
+	return existingIds, nil
+}
+
+func (store *memoryStore) CountRawGames(ctx context.Context, date string) (int64, error) {
+	games, err := store.FindRawGames(ctx, date)
+	return int64(len(games)), err
+}
+
+func (store *memoryStore) UpsertRawGames(ctx context.Context, games []RawNbaGame) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.rawGames.upsert(ctx, games)
+}
+
+func (store *memoryStore) FindRawOdds(ctx context.Context, date string, utcHour int) (*RawOddsResponse, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	odds := store.rawOdds.find(func(odds RawOddsResponse) bool { return odds.Date == date && odds.UtcHour == utcHour })
+	if len(odds) == 0 {
+		return nil, nil
+	}
+	return &odds[0], nil
+}
+
+func (store *memoryStore) CountRawOdds(ctx context.Context, date string, utcHours []int) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	odds := store.rawOdds.find(func(odds RawOddsResponse) bool { return odds.Date == date && slices.Contains(utcHours, odds.UtcHour) })
+	return int64(len(odds)), nil
+}
+
+func (store *memoryStore) UpsertRawOdds(ctx context.Context, odds []RawOddsResponse) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.rawOdds.upsert(ctx, odds)
+}
+
+func (store *memoryStore) FindCleanedGames(ctx context.Context, date string) ([]CleanedGame, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.cleanedGames.find(func(game CleanedGame) bool { return game.Date == date }), nil
+}
+
+func (store *memoryStore) CountCleanedGames(ctx context.Context, date string) (int64, error) {
+	games, err := store.FindCleanedGames(ctx, date)
+	return int64(len(games)), err
+}
+
+func (store *memoryStore) UpsertCleanedGames(ctx context.Context, games []CleanedGame) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.cleanedGames.upsert(ctx, games)
+}
+
+func (store *memoryStore) FindCleanedOdds(ctx context.Context, gameIds []string) ([]CleanedOdds, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.cleanedOdds.find(func(odds CleanedOdds) bool { return slices.Contains(gameIds, odds.GameId) }), nil
+}
+
+func (store *memoryStore) UpsertCleanedOdds(ctx context.Context, odds []CleanedOdds) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.cleanedOdds.upsert(ctx, odds)
+}
+
+func (store *memoryStore) UpsertProcessingErrors(ctx context.Context, failures []ProcessingError) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.processingErrors.upsert(ctx, failures)
+}
+
+func (store *memoryStore) DeleteProcessingErrors(ctx context.Context, process ProcessType, gameIds []string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.processingErrors.delete(func(failure ProcessingError) bool {
+		return failure.Process == string(process) && slices.Contains(gameIds, failure.GameId)
+	})
+	return nil
+}
+
+func (store *memoryStore) UpsertPipelineRun(ctx context.Context, run PipelineRun) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	doc, err := copyDocument(run)
+	if err != nil {
+		return err
+	}
+	store.pipelineRuns.put(doc)
+	return nil
+}
+
+func (store *memoryStore) FindPipelineRuns(ctx context.Context, dates []string) ([]PipelineRun, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	runs := store.pipelineRuns.find(func(run PipelineRun) bool { return slices.Contains(dates, run.GameDate) })
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].EndTime < runs[j].EndTime })
+	return runs, nil
+}
+
+/* Only guards against overlapping runs within the process, since the store is not shared between processes */
+func (store *memoryStore) AcquireLock(ctx context.Context, lock PipelineLock) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if holder := store.findLock(lock.LockId); !lockAvailable(holder, lock) {
+		return lockHeldError(*holder)
+	}
+	store.pipelineLocks.put(lock)
+	return nil
+}
+
+func (store *memoryStore) RenewLock(ctx context.Context, lock PipelineLock) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if holder := store.findLock(lock.LockId); holder == nil || !sameLockOwner(*holder, lock) {
+		return fmt.Errorf("%w: %s expired and was taken over or removed", ErrLockLost, lock.LockId)
+	}
+	store.pipelineLocks.put(lock)
+	return nil
+}
+
+func (store *memoryStore) ReleaseLock(ctx context.Context, lock PipelineLock) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.pipelineLocks.delete(func(holder PipelineLock) bool {
+		return holder.LockId == lock.LockId && sameLockOwner(holder, lock)
+	})
+	return nil
+}
+
+func (store *memoryStore) DeleteLock(ctx context.Context, lockId string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.pipelineLocks.delete(func(holder PipelineLock) bool { return holder.LockId == lockId })
+	return nil
+}
+
+func (store *memoryStore) findLock(lockId string) *PipelineLock {
+	locks := store.pipelineLocks.find(func(lock PipelineLock) bool { return lock.LockId == lockId })
+	if len(locks) == 0 {
+		return nil
+	}
+	return &locks[0]
+}
+
+func newMemoryCollection[T any](name string, filter func(T) bson.M) *memoryCollection[T] {
+	return &memoryCollection[T]{name: name, filter: filter, docs: make(map[string]T)}
+}
+
+func (collection *memoryCollection[T]) key(doc T) string {
+	return fmt.Sprint(collection.filter(doc))
+}
+
+func (collection *memoryCollection[T]) find(matches func(T) bool) []T {
+	var docs []T
+	for _, key := range collection.keys {
+		if doc := collection.docs[key]; matches(doc) {
+			docs = append(docs, doc)
+		}
+	}
+	return docs
+}
+
+func (collection *memoryCollection[T]) put(doc T) {
+	key := collection.key(doc)
+	if _, ok := collection.docs[key]; !ok {
+		collection.keys = append(collection.keys, key)
+	}
+	collection.docs[key] = doc
+}
+
+func (collection *memoryCollection[T]) delete(matches func(T) bool) {
+	keys := collection.keys[:0]
+	for _, key := range collection.keys {
+		if matches(collection.docs[key]) {
+			delete(collection.docs, key)
+		} else {
+			keys = append(keys, key)
+		}
+	}
+	collection.keys = keys
+}
+
+/* Counts writes the way a mongo bulk write does, a matched document is modified when a field changed */
+func (collection *memoryCollection[T]) upsert(ctx context.Context, docs []T) error {
+	if len(docs) == 0 {
+		loggerFrom(ctx).Info("Found 0 rows to upsert", "collection", collection.name)
+		return nil
+	}
+	if DryRun {
+		return collection.planUpserts(ctx, docs)
+	}
+
+	var matched, modified, upserted int64
+	for _, doc := range docs {
+		newDoc, err := copyDocument(doc)
+		if err != nil {
+			return err
+		}
+		existingDoc, ok := collection.docs[collection.key(doc)]
+		if !ok {
+			upserted += 1
+		} else {
+			matched += 1
+			oldFields, err1 := toBsonMap(existingDoc)
+			newFields, err2 := toBsonMap(newDoc)
+			if err1 != nil || err2 != nil {
+				return handleMultipleErrors(err1, err2)
+			}
+			if len(diffDocuments("", oldFields, newFields)) > 0 {
+				modified += 1
+			}
+		}
+		collection.put(newDoc)
+	}
+	recordCollectionWrites(ctx, collection.name, matched, modified, upserted)
+	return nil
+}
+
+func (collection *memoryCollection[T]) planUpserts(ctx context.Context, docs []T) error {
+	var writes = make([]plannedWrite, 0, len(docs))
+	for _, doc := range docs {
+		write := plannedWrite{filter: collection.filter(doc), newDoc: doc}
+		if existingDoc, ok := collection.docs[collection.key(doc)]; ok {
+			var err error
+			if write.existingDoc, err = toBsonMap(existingDoc); err != nil {
+				return err
+			}
+		}
+		writes = append(writes, write)
+	}
+	return planUpserts(ctx, collection.name, writes)
+}
+
+func copyDocument[T any](doc T) (copied T, err error) {
+	bytes, err := bson.Marshal(doc)
+	if err != nil {
+		return copied, err
+	}
+	err = bson.Unmarshal(bytes, &copied)
+	return copied, err
+}
+
+/* Reads a mongoexport --jsonArray file of the collection, when one exists */
+func seedMemoryCollection[T any](seedDirectory string, collection *memoryCollection[T]) error {
+	path := filepath.Join(seedDirectory, collection.name+".json")
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	/* Extended json can only be unmarshalled as a document, so the array is wrapped in one */
+	var seed struct {
+		Documents []T `bson:"documents"`
+	}
+	wrapped := append(append([]byte(`{"documents":`), contents...), '}')
+	if err = bson.UnmarshalExtJSON(wrapped, false, &seed); err != nil {
+		return errors.New("error reading seed file " + path + ": " + err.Error())
+	}
+	for _, doc := range seed.Documents {
+		collection.put(doc)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+Prometheus metrics in the text exposition format. Every series carries the process label, so the
+textfiles of different processes can sit in the same node exporter directory
+*/
+const (
+	counterMetric = "counter"
+	gaugeMetric   = "gauge"
+)
+
+type metric struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+	mu         sync.Mutex
+	values     map[string]*metricValue
+}
+
+type metricValue struct {
+	labelValues []string
+	value       float64
+}
+
+var registeredMetrics []*metric
+var metricsProcess string
+
+var (
+	stageDurationSeconds = newMetric("nba_stage_duration_seconds_total", counterMetric, "Time spent running each stage", "stage", "status")
+	stageRuns            = newMetric("nba_stage_runs_total", counterMetric, "Stage runs by outcome", "stage", "status")
+	gamesProcessed       = newMetric("nba_games_processed_total", counterMetric, "Games processed by each stage, including failed games", "stage")
+	gamesFailed          = newMetric("nba_games_failed_total", counterMetric, "Games recorded as failed by each stage in lenient mode", "stage")
+	oddsApiRequests      = newMetric("nba_odds_api_requests_total", counterMetric, "Odds API requests by http status code, 0 when no response was received", "status_code")
+	oddsApiRemaining     = newMetric("nba_odds_api_requests_remaining", gaugeMetric, "Remaining odds API quota reported by the last response")
+	oddsApiUsed          = newMetric("nba_odds_api_requests_used", gaugeMetric, "Used odds API quota reported by the last response")
+	mongoWrites          = newMetric("nba_mongo_writes_total", counterMetric, "Documents written per collection, by matched, modified or upserted", "collection", "result")
+	csvRows              = newMetric("nba_csv_rows_total", counterMetric, "Csv rows written per csv, by inserted, updated or deleted", "csv", "result")
+	runDurationSeconds   = newMetric("nba_last_run_duration_seconds", gaugeMetric, "Duration of the last run")
+	runTimestampSeconds  = newMetric("nba_last_run_timestamp_seconds", gaugeMetric, "Unix time the last run finished")
+	runSuccess           = newMetric("nba_last_run_success", gaugeMetric, "1 if the last run succeeded, 0.5 if it partially succeeded and 0 if it failed")
+)
+
+func newMetric(name string, kind string, help string, labelNames ...string) *metric {
+	m := &metric{name: name, help: help, kind: kind, labelNames: labelNames, values: make(map[string]*metricValue)}
+	registeredMetrics = append(registeredMetrics, m)
+	return m
+}
+
+func (m *metric) add(delta float64, labelValues ...string) {
+	m.update(labelValues, func(value *metricValue) { value.value += delta })
+}
+
+func (m *metric) set(newValue float64, labelValues ...string) {
+	m.update(labelValues, func(value *metricValue) { value.value = newValue })
+}
+
+func (m *metric) update(labelValues []string, apply func(*metricValue)) {
+	if len(labelValues) != len(m.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", m.name, len(m.labelNames), len(labelValues)))
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := strings.Join(labelValues, "\xff")
+	value, ok := m.values[key]
+	if !ok {
+		value = &metricValue{labelValues: labelValues}
+		m.values[key] = value
+	}
+	apply(value)
+}
+
+func (m *metric) writeTo(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.values) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+
+	keys := make([]string, 0, len(m.values))
+	for key := range m.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := m.values[key]
+		labels := []string{`process="` + escapeLabelValue(metricsProcess) + `"`}
+		for i, labelName := range m.labelNames {
+			labels = append(labels, labelName+`="`+escapeLabelValue(value.labelValues[i])+`"`)
+		}
+		fmt.Fprintf(w, "%s{%s} %s\n", m.name, strings.Join(labels, ","), strconv.FormatFloat(value.value, 'g', -1, 64))
+	}
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func writeMetrics(w io.Writer) {
+	for _, m := range registeredMetrics {
+		m.writeTo(w)
+	}
+}
+
+/* Written atomically, so node exporter never reads a half written file */
+func writeMetricsTextfile(directory string) error {
+	if directory == "" {
+		return nil
+	}
+
+	path := filepath.Join(directory, "nba_"+metricsProcess+".prom")
+	err := writeFileAtomically(path, func(w io.Writer) error {
+		writeMetrics(w)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	Logger.Info("Wrote metrics textfile", "path", path)
+	return nil
+}
+
+/* Serves /metrics until the process exits. Meant for long lived modes, where a textfile written at exit comes too late */
+func serveMetrics(listenAddress string) error {
+	if listenAddress == "" {
+		return nil
+	}
+	listener, err := net.Listen("tcp", listenAddress)
+	if err != nil {
+		return errors.New("error starting metrics listener: " + err.Error())
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w)
+	})
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			Logger.Error("Metrics listener stopped", "error", err)
+		}
+	}()
+	Logger.Info("Serving metrics", "address", listener.Addr().String())
+	return nil
+}
+
+func recordStageMetrics(stage ProcessType, duration time.Duration, err error) {
+	status := statusForError(err)
+	stageDurationSeconds.add(duration.Seconds(), string(stage), status)
+	stageRuns.add(1, string(stage), status)
+}
+
+func recordRunMetrics(duration time.Duration, err error) {
+	runDurationSeconds.set(duration.Seconds())
+	runTimestampSeconds.set(float64(time.Now().Unix()))
+	switch statusForError(err) {
+	case statusSuccess:
+		runSuccess.set(1)
+	case statusPartialSuccess:
+		runSuccess.set(0.5)
+	default:
+		runSuccess.set(0)
+	}
+}
+
+/* The odds api reports its quota in response headers */
+func recordOddsApiResponse(response *http.Response) {
+	if response == nil {
+		oddsApiRequests.add(1, "0")
+		return
+	}
+	oddsApiRequests.add(1, strconv.Itoa(response.StatusCode))
+	if remaining, err := strconv.ParseFloat(response.Header.Get("x-requests-remaining"), 64); err == nil {
+		oddsApiRemaining.set(remaining)
+	}
+	if used, err := strconv.ParseFloat(response.Header.Get("x-requests-used"), 64); err == nil {
+		oddsApiUsed.set(used)
+	}
+}
@@ -0,0 +1,92 @@
+package helpers
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+/*
+Copies every collection of the configured MongoDB schema into the SQLite database, in batches.
+Documents already in SQLite are replaced, so the migration can be run again after a failure
+*/
+func MigrateMongoToSqlite() (err error) {
+	ctx := context.Background()
+	client, err := loadMongoDbClient(*Config)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err1 := client.Disconnect(ctx); err == nil {
+			err = err1
+		}
+	}()
+	store, err := newSqliteStore(Config.Database.SqlitePath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err1 := store.Close(ctx); err == nil {
+			err = err1
+		}
+	}()
+
+	Logger.Info("Migrating MongoDB collections to SQLite", "schema", Config.Database.Schema, "sqlitePath", Config.Database.SqlitePath)
+	err1 := migrateCollection(ctx, getTeamMetadataCollection(client, Config.Database.Schema), store.upsertTeamMetadata)
+	err2 := migrateCollection(ctx, getRawGamesCollection(client, Config.Database.Schema), store.UpsertRawGames)
+	err3 := migrateCollection(ctx, getHistoricalOddscollection(client, Config.Database.Schema), store.UpsertRawOdds)
+	err4 := migrateCollection(ctx, getCleanedGamesCollection(client, Config.Database.Schema), store.UpsertCleanedGames)
+	err5 := migrateCollection(ctx, getCleanedOddsCollection(client, Config.Database.Schema), store.UpsertCleanedOdds)
+	err6 := migrateCollection(ctx, getProcessingErrorsCollection(client, Config.Database.Schema), store.UpsertProcessingErrors)
+	err7 := migrateCollection(ctx, getPipelineRunsCollection(client, Config.Database.Schema), func(ctx context.Context, runs []PipelineRun) error {
+		if DryRun {
+			loggerFrom(ctx).Info("Dry run: would copy pipeline runs", "count", len(runs))
+			return nil
+		}
+		for _, run := range runs {
+			if err := store.UpsertPipelineRun(ctx, run); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return handleMultipleErrors(err1, err2, err3, err4, err5, err6, err7)
+}
+
+func migrateCollection[T any](ctx context.Context, dbCollection *mongo.Collection, upsert func(context.Context, []T) error) error {
+	logger := Logger.With("collection", dbCollection.Name())
+	cursor, err := dbCollection.Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var numMigrated int
+	batch := make([]T, 0, migrationBatchSize)
+	for {
+		hasNext := cursor.Next(ctx)
+		if hasNext {
+			var doc T
+			if err = cursor.Decode(&doc); err != nil {
+				return err
+			}
+			batch = append(batch, doc)
+		}
+		if len(batch) == migrationBatchSize || (!hasNext && len(batch) > 0) {
+			if err = upsert(ctx, batch); err != nil {
+				return err
+			}
+			numMigrated += len(batch)
+			batch = batch[:0]
+		}
+		if !hasNext {
+			break
+		}
+	}
+	if err = cursor.Err(); err != nil {
+		return err
+	}
+	logger.Info("Migrated collection", "documents", numMigrated)
+	return nil
+}
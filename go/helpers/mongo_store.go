@@ -0,0 +1,273 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/* Store backed by the MongoDB collections */
+type mongoStore struct {
+	client *mongo.Client
+	schema string
+}
+
+func newMongoStore(config NbaConfig) (*mongoStore, error) {
+	client, err := loadMongoDbClient(config)
+	if err != nil {
+		return nil, err
+	}
+	return &mongoStore{client: client, schema: config.Database.Schema}, nil
+}
+
+func (store *mongoStore) Close(ctx context.Context) error {
+	return store.client.Disconnect(ctx)
+}
+
+func (store *mongoStore) FindTeamMetadata(ctx context.Context) (teamMetadata []TeamMetadata, err error) {
+	cursor, err := getTeamMetadataCollection(store.client, store.schema).Find(ctx, bson.M{})
+	if err == nil {
+		err = cursor.All(ctx, &teamMetadata)
+	}
+	if err != nil {
+		return nil, errors.New("error doing db lookup for team metadata")
+	}
+	return teamMetadata, nil
+}
+
+func (store *mongoStore) FindRawGames(ctx context.Context, date string) (rawGames []RawNbaGame, err error) {
+	cursor, err := getRawGamesCollection(store.client, store.schema).Find(ctx, dateFieldStringFilter(date))
+	if err == nil {
+		err = cursor.All(ctx, &rawGames)
+	}
+	if err != nil {
+		return nil, errors.New("error fetching from raw games DB")
+	}
+	return rawGames, nil
+}
+
+func (store *mongoStore) FindExistingRawGameIds(ctx context.Context, gameIds []string) ([]string, error) {
+	existingIds, err := getRawGamesCollection(store.client, store.schema).Distinct(ctx, "gameId", gameIdsFilter(gameIds))
+	if err != nil {
+		return nil, err
+	}
+	var existing = make([]string, 0, len(existingIds))
+	for _, gameId := range existingIds {
+		existing = append(existing, fmt.Sprint(gameId))
+	}
+	return existing, nil
+}
+
+func (store *mongoStore) CountRawGames(ctx context.Context, date string) (int64, error) {
+	return getRawGamesCollection(store.client, store.schema).CountDocuments(ctx, dateFieldStringFilter(date))
+}
+
+func (store *mongoStore) UpsertRawGames(ctx context.Context, games []RawNbaGame) error {
+	var operations = make([]mongo.WriteModel, 0, len(games))
+	for _, doc := range games {
+		operations = append(operations, upsertModel(gameIdFilter(doc.GameId), doc))
+	}
+	_, err := upsertItemsGeneric(ctx, operations, getRawGamesCollection(store.client, store.schema))
+	return err
+}
+
+func (store *mongoStore) FindRawOdds(ctx context.Context, date string, utcHour int) (*RawOddsResponse, error) {
+	var rawOdds RawOddsResponse
+	err := getHistoricalOddscollection(store.client, store.schema).FindOne(ctx, rawOddsDbFilter(date, utcHour)).Decode(&rawOdds)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &rawOdds, nil
+}
+
+func (store *mongoStore) CountRawOdds(ctx context.Context, date string, utcHours []int) (int64, error) {
+	return getHistoricalOddscollection(store.client, store.schema).CountDocuments(ctx, bson.M{
+		"date":    date,
+		"utcHour": bson.M{"$in": utcHours},
+	})
+}
+
+func (store *mongoStore) UpsertRawOdds(ctx context.Context, odds []RawOddsResponse) error {
+	var operations = make([]mongo.WriteModel, 0, len(odds))
+	for _, doc := range odds {
+		operations = append(operations, upsertModel(rawOddsDbFilter(doc.Date, doc.UtcHour), doc))
+	}
+	_, err := upsertItemsGeneric(ctx, operations, getHistoricalOddscollection(store.client, store.schema))
+	return err
+}
+
+func (store *mongoStore) FindCleanedGames(ctx context.Context, date string) (games []CleanedGame, err error) {
+	cursor, err := getCleanedGamesCollection(store.client, store.schema).Find(ctx, dateFieldStringFilter(date))
+	if err == nil {
+		err = cursor.All(ctx, &games)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return games, nil
+}
+
+func (store *mongoStore) CountCleanedGames(ctx context.Context, date string) (int64, error) {
+	return getCleanedGamesCollection(store.client, store.schema).CountDocuments(ctx, dateFieldStringFilter(date))
+}
+
+func (store *mongoStore) UpsertCleanedGames(ctx context.Context, games []CleanedGame) error {
+	var operations = make([]mongo.WriteModel, 0, len(games))
+	for _, doc := range games {
+		operations = append(operations, upsertModel(gameIdFilter(doc.GameId), doc))
+	}
+	_, err := upsertItemsGeneric(ctx, operations, getCleanedGamesCollection(store.client, store.schema))
+	return err
+}
+
+func (store *mongoStore) FindCleanedOdds(ctx context.Context, gameIds []string) (odds []CleanedOdds, err error) {
+	cursor, err := getCleanedOddsCollection(store.client, store.schema).Find(ctx, gameIdsFilter(gameIds))
+	if err == nil {
+		err = cursor.All(ctx, &odds)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return odds, nil
+}
+
+/* Keyed by gameId. Documents written before were inserted again on every run, see the README for removing the copies */
+func (store *mongoStore) UpsertCleanedOdds(ctx context.Context, odds []CleanedOdds) error {
+	var operations = make([]mongo.WriteModel, 0, len(odds))
+	for _, doc := range odds {
+		operations = append(operations, upsertModel(gameIdFilter(doc.GameId), doc))
+	}
+	_, err := upsertItemsGeneric(ctx, operations, getCleanedOddsCollection(store.client, store.schema))
+	return err
+}
+
+func (store *mongoStore) UpsertProcessingErrors(ctx context.Context, failures []ProcessingError) error {
+	var operations = make([]mongo.WriteModel, 0, len(failures))
+	for _, failure := range failures {
+		operations = append(operations, upsertModel(processingErrorFilter(failure.GameId, ProcessType(failure.Process)), failure))
+	}
+	_, err := upsertItemsGeneric(ctx, operations, getProcessingErrorsCollection(store.client, store.schema))
+	return err
+}
+
+func (store *mongoStore) DeleteProcessingErrors(ctx context.Context, process ProcessType, gameIds []string) error {
+	_, err := getProcessingErrorsCollection(store.client, store.schema).DeleteMany(ctx, bson.M{
+		"process": string(process),
+		"gameId":  bson.M{"$in": gameIds},
+	})
+	return err
+}
+
+func (store *mongoStore) UpsertPipelineRun(ctx context.Context, run PipelineRun) error {
+	_, err := getPipelineRunsCollection(store.client, store.schema).UpdateOne(ctx,
+		pipelineRunFilter(run.RunId, run.GameDate, run.Stage),
+		bson.M{"$set": run},
+		options.Update().SetUpsert(true))
+	return err
+}
+
+func (store *mongoStore) FindPipelineRuns(ctx context.Context, dates []string) (runs []PipelineRun, err error) {
+	cursor, err := getPipelineRunsCollection(store.client, store.schema).Find(ctx,
+		bson.M{"gameDate": bson.M{"$in": dates}},
+		options.Find().SetSort(bson.D{{Key: "endTime", Value: 1}}))
+	if err == nil {
+		err = cursor.All(ctx, &runs)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+/*
+The lock document is upserted only when it is expired or already ours, otherwise the upsert conflicts
+with the held lock's _id. The TTL index removes expired locks left behind by crashed processes
+*/
+func (store *mongoStore) AcquireLock(ctx context.Context, lock PipelineLock) error {
+	locks := getPipelineLocksCollection(store.client, store.schema)
+	_, err := locks.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"_id": lock.LockId, "$or": bson.A{
+		bson.M{"expiresAt": bson.M{"$lte": time.Now()}},
+		lockOwnerFilter(lock),
+	}}
+	_, err = locks.UpdateOne(ctx, filter, bson.M{"$set": lock}, options.Update().SetUpsert(true))
+	if !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	var holder PipelineLock
+	if err = locks.FindOne(ctx, bson.M{"_id": lock.LockId}).Decode(&holder); err != nil {
+		return fmt.Errorf("%w: %s", ErrLockHeld, lock.LockId)
+	}
+	return lockHeldError(holder)
+}
+
+func (store *mongoStore) RenewLock(ctx context.Context, lock PipelineLock) error {
+	filter := lockOwnerFilter(lock)
+	filter["_id"] = lock.LockId
+	result, err := getPipelineLocksCollection(store.client, store.schema).UpdateOne(ctx, filter,
+		bson.M{"$set": bson.M{"expiresAt": lock.ExpiresAt}})
+	if err == nil && result.MatchedCount == 0 {
+		return fmt.Errorf("%w: %s expired and was taken over or removed", ErrLockLost, lock.LockId)
+	}
+	return err
+}
+
+func (store *mongoStore) ReleaseLock(ctx context.Context, lock PipelineLock) error {
+	filter := lockOwnerFilter(lock)
+	filter["_id"] = lock.LockId
+	_, err := getPipelineLocksCollection(store.client, store.schema).DeleteOne(ctx, filter)
+	return err
+}
+
+func (store *mongoStore) DeleteLock(ctx context.Context, lockId string) error {
+	_, err := getPipelineLocksCollection(store.client, store.schema).DeleteOne(ctx, bson.M{"_id": lockId})
+	return err
+}
+
+func lockOwnerFilter(lock PipelineLock) bson.M {
+	return bson.M{"runId": lock.RunId, "host": lock.Host, "pid": lock.Pid}
+}
+
+func upsertModel(filter bson.M, doc interface{}) mongo.WriteModel {
+	return mongo.NewUpdateOneModel().
+		SetFilter(filter).
+		SetUpdate(bson.M{"$set": doc}).
+		SetUpsert(true)
+}
+
+/* Planned writes of a dry run, compared with the documents currently stored */
+func planMongoUpserts(ctx context.Context, operations []mongo.WriteModel, dbCollection *mongo.Collection) error {
+	var writes = make([]plannedWrite, 0, len(operations))
+	for _, operation := range operations {
+		update, ok := operation.(*mongo.UpdateOneModel)
+		if !ok {
+			return fmt.Errorf("dry run cannot plan write of type %T", operation)
+		}
+		filter, err := toBsonMap(update.Filter)
+		if err != nil {
+			return err
+		}
+
+		var existingDoc bson.M
+		err = dbCollection.FindOne(ctx, update.Filter).Decode(&existingDoc)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+		writes = append(writes, plannedWrite{filter: filter, existingDoc: existingDoc, newDoc: update.Update.(bson.M)["$set"]})
+	}
+	return planUpserts(ctx, dbCollection.Name(), writes)
+}
@@ -0,0 +1,301 @@
+package helpers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+/*
+Minimal parquet writer for flat tables of required columns. Every column is written as one
+gzip compressed, plain encoded data page in a single row group, with the file metadata thrift
+compact encoded. Enough for the per date exports, which are read back with DuckDB or pandas
+*/
+type parquetTable struct {
+	columns []*parquetColumn
+	numRows int
+}
+
+type parquetColumn struct {
+	name          string
+	physicalType  int32
+	convertedType int32
+	values        bytes.Buffer
+}
+
+/* Parquet's physical types, converted types and the enums of the file metadata */
+const (
+	parquetInt32     int32 = 1
+	parquetInt64     int32 = 2
+	parquetDouble    int32 = 5
+	parquetByteArray int32 = 6
+
+	parquetNoConvertedType int32 = -1
+	parquetUtf8            int32 = 0
+	parquetDate            int32 = 6
+
+	parquetRequired      int32 = 0
+	parquetPlain         int32 = 0
+	parquetRle           int32 = 3
+	parquetGzip          int32 = 2
+	parquetDataPage      int32 = 0
+	parquetFormatMagic         = "PAR1"
+	parquetFormatVersion int32 = 1
+)
+
+func stringParquetColumn(name string) *parquetColumn {
+	return &parquetColumn{name: name, physicalType: parquetByteArray, convertedType: parquetUtf8}
+}
+
+func int32ParquetColumn(name string) *parquetColumn {
+	return &parquetColumn{name: name, physicalType: parquetInt32, convertedType: parquetNoConvertedType}
+}
+
+func int64ParquetColumn(name string) *parquetColumn {
+	return &parquetColumn{name: name, physicalType: parquetInt64, convertedType: parquetNoConvertedType}
+}
+
+func doubleParquetColumn(name string) *parquetColumn {
+	return &parquetColumn{name: name, physicalType: parquetDouble, convertedType: parquetNoConvertedType}
+}
+
+/* Dates are stored as days since the unix epoch */
+func dateParquetColumn(name string) *parquetColumn {
+	return &parquetColumn{name: name, physicalType: parquetInt32, convertedType: parquetDate}
+}
+
+func newParquetTable(columns ...*parquetColumn) *parquetTable {
+	return &parquetTable{columns: columns}
+}
+
+/* Values are given in column order, as strings, int32, int64, float64 or time.Time for dates */
+func (table *parquetTable) addRow(values ...interface{}) error {
+	if len(values) != len(table.columns) {
+		return fmt.Errorf("parquet row has %d values for %d columns", len(values), len(table.columns))
+	}
+	for i, column := range table.columns {
+		if err := column.append(values[i]); err != nil {
+			return err
+		}
+	}
+	table.numRows += 1
+	return nil
+}
+
+func (column *parquetColumn) append(value interface{}) error {
+	switch typed := value.(type) {
+	case string:
+		if column.physicalType == parquetByteArray {
+			binary.Write(&column.values, binary.LittleEndian, uint32(len(typed)))
+			column.values.WriteString(typed)
+			return nil
+		}
+	case int32:
+		if column.physicalType == parquetInt32 && column.convertedType != parquetDate {
+			return binary.Write(&column.values, binary.LittleEndian, typed)
+		}
+	case int64:
+		if column.physicalType == parquetInt64 {
+			return binary.Write(&column.values, binary.LittleEndian, typed)
+		}
+	case float64:
+		if column.physicalType == parquetDouble {
+			return binary.Write(&column.values, binary.LittleEndian, math.Float64bits(typed))
+		}
+	case time.Time:
+		if column.convertedType == parquetDate {
+			days := typed.Unix() / int64((24 * time.Hour).Seconds())
+			return binary.Write(&column.values, binary.LittleEndian, int32(days))
+		}
+	}
+	return fmt.Errorf("parquet column %s cannot hold a value of type %T", column.name, value)
+}
+
+/* Layout: magic, the column chunks, the file metadata, its length and the magic again */
+func (table *parquetTable) writeTo(w io.Writer) error {
+	var file bytes.Buffer
+	file.WriteString(parquetFormatMagic)
+
+	var chunks []thriftStruct
+	var totalByteSize int64
+	for _, column := range table.columns {
+		var compressed bytes.Buffer
+		gzipWriter := gzip.NewWriter(&compressed)
+		if _, err := gzipWriter.Write(column.values.Bytes()); err != nil {
+			return err
+		}
+		if err := gzipWriter.Close(); err != nil {
+			return err
+		}
+
+		pageHeader := thriftStruct{
+			{1, parquetDataPage},
+			{2, int32(column.values.Len())},
+			{3, int32(compressed.Len())},
+			{5, thriftStruct{
+				{1, int32(table.numRows)},
+				{2, parquetPlain},
+				{3, parquetRle},
+				{4, parquetRle},
+			}},
+		}
+		var header bytes.Buffer
+		pageHeader.write(&header)
+
+		dataPageOffset := int64(file.Len())
+		file.Write(header.Bytes())
+		file.Write(compressed.Bytes())
+		uncompressedSize := int64(header.Len() + column.values.Len())
+		compressedSize := int64(header.Len() + compressed.Len())
+		totalByteSize += uncompressedSize
+
+		chunks = append(chunks, thriftStruct{
+			{2, dataPageOffset},
+			{3, thriftStruct{
+				{1, column.physicalType},
+				{2, thriftList{parquetPlain, parquetRle}},
+				{3, thriftList{column.name}},
+				{4, parquetGzip},
+				{5, int64(table.numRows)},
+				{6, uncompressedSize},
+				{7, compressedSize},
+				{9, dataPageOffset},
+			}},
+		})
+	}
+
+	schema := thriftList{thriftStruct{
+		{4, "schema"},
+		{5, int32(len(table.columns))},
+	}}
+	for _, column := range table.columns {
+		element := thriftStruct{
+			{1, column.physicalType},
+			{3, parquetRequired},
+			{4, column.name},
+		}
+		if column.convertedType != parquetNoConvertedType {
+			element = append(element, thriftField{6, column.convertedType})
+		}
+		schema = append(schema, element)
+	}
+	columnChunks := make(thriftList, 0, len(chunks))
+	for _, chunk := range chunks {
+		columnChunks = append(columnChunks, chunk)
+	}
+
+	metadata := thriftStruct{
+		{1, parquetFormatVersion},
+		{2, schema},
+		{3, int64(table.numRows)},
+		{4, thriftList{thriftStruct{
+			{1, columnChunks},
+			{2, totalByteSize},
+			{3, int64(table.numRows)},
+		}}},
+		{6, "nba_main"},
+	}
+	metadataStart := file.Len()
+	metadata.write(&file)
+	binary.Write(&file, binary.LittleEndian, uint32(file.Len()-metadataStart))
+	file.WriteString(parquetFormatMagic)
+
+	_, err := w.Write(file.Bytes())
+	return err
+}
+
+/*
+Thrift compact protocol, only what the parquet file metadata needs. Fields are written in the
+order given, which must be by increasing field id
+*/
+type thriftField struct {
+	id    int16
+	value interface{}
+}
+
+type thriftStruct []thriftField
+
+type thriftList []interface{}
+
+const (
+	thriftI32        byte = 5
+	thriftI64        byte = 6
+	thriftBinary     byte = 8
+	thriftListType   byte = 9
+	thriftStructType byte = 12
+)
+
+func (s thriftStruct) write(buf *bytes.Buffer) {
+	var lastId int16
+	for _, field := range s {
+		fieldType := thriftType(field.value)
+		if delta := field.id - lastId; delta > 0 && delta <= 15 {
+			buf.WriteByte(byte(delta)<<4 | fieldType)
+		} else {
+			buf.WriteByte(fieldType)
+			writeVarint(buf, zigzag(int64(field.id)))
+		}
+		writeThriftValue(buf, field.value)
+		lastId = field.id
+	}
+	buf.WriteByte(0)
+}
+
+func writeThriftValue(buf *bytes.Buffer, value interface{}) {
+	switch typed := value.(type) {
+	case int32:
+		writeVarint(buf, zigzag(int64(typed)))
+	case int64:
+		writeVarint(buf, zigzag(typed))
+	case string:
+		writeVarint(buf, uint64(len(typed)))
+		buf.WriteString(typed)
+	case thriftStruct:
+		typed.write(buf)
+	case thriftList:
+		elementType := thriftStructType
+		if len(typed) > 0 {
+			elementType = thriftType(typed[0])
+		}
+		if len(typed) < 15 {
+			buf.WriteByte(byte(len(typed))<<4 | elementType)
+		} else {
+			buf.WriteByte(0xf0 | elementType)
+			writeVarint(buf, uint64(len(typed)))
+		}
+		for _, element := range typed {
+			writeThriftValue(buf, element)
+		}
+	}
+}
+
+func thriftType(value interface{}) byte {
+	switch value.(type) {
+	case int32:
+		return thriftI32
+	case int64:
+		return thriftI64
+	case string:
+		return thriftBinary
+	case thriftList:
+		return thriftListType
+	default:
+		return thriftStructType
+	}
+}
+
+func zigzag(n int64) uint64 {
+	return uint64(n<<1) ^ uint64(n>>63)
+}
+
+func writeVarint(buf *bytes.Buffer, n uint64) {
+	for n >= 0x80 {
+		buf.WriteByte(byte(n) | 0x80)
+		n >>= 7
+	}
+	buf.WriteByte(byte(n))
+}
@@ -0,0 +1,319 @@
+package helpers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+/* Reads a parquet file back as json rows with DuckDB or pyarrow, or returns false when neither is installed */
+func readParquetRowsExternally(t *testing.T, path string) ([]map[string]interface{}, bool) {
+	t.Helper()
+	var command *exec.Cmd
+	if duckdb, err := exec.LookPath("duckdb"); err == nil {
+		command = exec.Command(duckdb, "-json", "-c", "SELECT * FROM read_parquet('"+path+"')")
+	} else if python, err := exec.LookPath("python3"); err == nil && exec.Command(python, "-c", "import pyarrow.parquet").Run() == nil {
+		command = exec.Command(python, "-c", "import json, sys, pyarrow.parquet as pq; print(json.dumps(pq.read_table(sys.argv[1]).to_pylist(), default=str))", path)
+	} else {
+		return nil, false
+	}
+
+	var stderr bytes.Buffer
+	command.Stderr = &stderr
+	output, err := command.Output()
+	if err != nil {
+		t.Fatalf("reading %s: %v: %s", path, err, stderr.String())
+	}
+	var rows []map[string]interface{}
+	if err = json.Unmarshal(output, &rows); err != nil {
+		t.Fatalf("parsing rows read from %s: %v: %s", path, err, output)
+	}
+	return rows, true
+}
+
+/*
+Decodes a parquet file as written by parquetTable, independently of the writer: the footer's thrift
+metadata, then each column's page. Values come back as json would have them, numbers as float64 and
+dates as 2006-01-02, so the rows compare equal to those DuckDB or pyarrow read
+*/
+func decodeParquetRows(t *testing.T, path string) []map[string]interface{} {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) < 12 || string(data[:4]) != parquetFormatMagic || string(data[len(data)-4:]) != parquetFormatMagic {
+		t.Fatalf("%s does not start and end with %s", path, parquetFormatMagic)
+	}
+	footerLength := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := &thriftReader{data: data[len(data)-8-footerLength : len(data)-8]}
+	metadata := footer.readStruct(t)
+	if footer.pos != len(footer.data) {
+		t.Fatalf("file metadata is %d bytes, the footer length says %d", footer.pos, len(footer.data))
+	}
+
+	numRows := int(metadata[3].(int64))
+	schema := metadata[2].([]interface{})
+	if numChildren := schema[0].(map[int16]interface{})[5].(int64); int(numChildren) != len(schema)-1 {
+		t.Fatalf("schema root has %d children, found %d columns", numChildren, len(schema)-1)
+	}
+	rowGroups := metadata[4].([]interface{})
+	if len(rowGroups) != 1 {
+		t.Fatalf("expected one row group, found %d", len(rowGroups))
+	}
+	rowGroup := rowGroups[0].(map[int16]interface{})
+	chunks := rowGroup[1].([]interface{})
+	if int(rowGroup[3].(int64)) != numRows || len(chunks) != len(schema)-1 {
+		t.Fatalf("row group has %d rows and %d columns, expected %d and %d", rowGroup[3], len(chunks), numRows, len(schema)-1)
+	}
+
+	rows := make([]map[string]interface{}, numRows)
+	for i := range rows {
+		rows[i] = make(map[string]interface{})
+	}
+	for i, chunk := range chunks {
+		element := schema[i+1].(map[int16]interface{})
+		name := element[4].(string)
+		chunkMetadata := chunk.(map[int16]interface{})[3].(map[int16]interface{})
+		if path := chunkMetadata[3].([]interface{}); len(path) != 1 || path[0] != name {
+			t.Fatalf("column chunk %d has path %v, the schema names it %s", i, path, name)
+		}
+		if chunkMetadata[1] != element[1] || chunkMetadata[4] != int64(parquetGzip) || int(chunkMetadata[5].(int64)) != numRows {
+			t.Fatalf("column %s has chunk metadata %v, inconsistent with its schema %v", name, chunkMetadata, element)
+		}
+
+		pageReader := &thriftReader{data: data[chunkMetadata[9].(int64):]}
+		pageHeader := pageReader.readStruct(t)
+		dataPageHeader := pageHeader[5].(map[int16]interface{})
+		if pageHeader[1] != int64(parquetDataPage) || int(dataPageHeader[1].(int64)) != numRows || dataPageHeader[2] != int64(parquetPlain) {
+			t.Fatalf("column %s has page header %v", name, pageHeader)
+		}
+		compressed := pageReader.data[pageReader.pos : pageReader.pos+int(pageHeader[3].(int64))]
+		gzipReader, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		values, err := io.ReadAll(gzipReader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(values) != int(pageHeader[2].(int64)) {
+			t.Fatalf("column %s has %d bytes of values, its page header says %d", name, len(values), pageHeader[2])
+		}
+
+		convertedType, hasConvertedType := element[6]
+		for row := 0; row < numRows; row++ {
+			switch element[1] {
+			case int64(parquetInt32):
+				value := int32(binary.LittleEndian.Uint32(values))
+				values = values[4:]
+				if hasConvertedType && convertedType == int64(parquetDate) {
+					rows[row][name] = time.Unix(int64(value)*int64((24*time.Hour).Seconds()), 0).UTC().Format(dateLayout)
+				} else {
+					rows[row][name] = float64(value)
+				}
+			case int64(parquetInt64):
+				rows[row][name] = float64(int64(binary.LittleEndian.Uint64(values)))
+				values = values[8:]
+			case int64(parquetDouble):
+				rows[row][name] = math.Float64frombits(binary.LittleEndian.Uint64(values))
+				values = values[8:]
+			case int64(parquetByteArray):
+				length := binary.LittleEndian.Uint32(values)
+				rows[row][name] = string(values[4 : 4+length])
+				values = values[4+length:]
+			default:
+				t.Fatalf("column %s has unexpected physical type %v", name, element[1])
+			}
+		}
+		if len(values) != 0 {
+			t.Fatalf("column %s has %d bytes left after %d values", name, len(values), numRows)
+		}
+	}
+	return rows
+}
+
+/* Thrift compact protocol reader for the types the writer uses. Structs are maps by field id, integers int64 */
+type thriftReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *thriftReader) readStruct(t *testing.T) map[int16]interface{} {
+	t.Helper()
+	fields := make(map[int16]interface{})
+	var lastId int16
+	for {
+		header := r.data[r.pos]
+		r.pos += 1
+		if header == 0 {
+			return fields
+		}
+		id := lastId + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(r.readZigzag())
+		}
+		fields[id] = r.readValue(t, header&0x0f)
+		lastId = id
+	}
+}
+
+func (r *thriftReader) readValue(t *testing.T, valueType byte) interface{} {
+	t.Helper()
+	switch valueType {
+	case thriftI32, thriftI64:
+		return r.readZigzag()
+	case thriftBinary:
+		length := int(r.readVarint())
+		value := string(r.data[r.pos : r.pos+length])
+		r.pos += length
+		return value
+	case thriftListType:
+		header := r.data[r.pos]
+		r.pos += 1
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(r.readVarint())
+		}
+		elements := make([]interface{}, size)
+		for i := range elements {
+			elements[i] = r.readValue(t, header&0x0f)
+		}
+		return elements
+	case thriftStructType:
+		return r.readStruct(t)
+	default:
+		t.Fatalf("unexpected thrift type %d at byte %d", valueType, r.pos)
+		return nil
+	}
+}
+
+func (r *thriftReader) readVarint() uint64 {
+	var value uint64
+	for shift := 0; ; shift += 7 {
+		b := r.data[r.pos]
+		r.pos += 1
+		value |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return value
+		}
+	}
+}
+
+func (r *thriftReader) readZigzag() int64 {
+	value := r.readVarint()
+	return int64(value>>1) ^ -int64(value&1)
+}
+
+func TestParquetFilesRoundTrip(t *testing.T) {
+	cfg := useTestConfig(t)
+	gameRows := []GameCsv{{
+		GameId:               "0022400061",
+		SeasonId:             "22024",
+		Date:                 "2024-10-22",
+		StartTime:            "7:30 PM",
+		AwayTeamAbbreviation: "MIN",
+		AwayTeamId:           1610612750,
+		HomeTeamAbbreviation: "LAL",
+		HomeTeamId:           1610612747,
+		AwayMl:               1.91,
+		HomeMl:               1.95,
+		AwaySpread:           -1.5,
+		HomeSpread:           1.5,
+		PregameTotal:         224.5,
+		AwayFinalScore:       103,
+		HomeFinalScore:       110,
+		Overtime:             1,
+		OvertimePeriods:      1,
+	}}
+	playsRows := []PlayByPlayCsv{
+		{GameId: "0022400061", SecondsElapsed: 0, Period: 1, SecondsRemaining: 720},
+		{GameId: "0022400061", SecondsElapsed: 3180, Period: 5, SecondsRemaining: 0, AwayScore: 103, HomeScore: 110, UnderdogScore: 110, FavoriteScore: 103, FavoriteMargin: -7},
+	}
+	var gameRecords, playsRecords [][]string
+	for _, row := range gameRows {
+		gameRecords = append(gameRecords, marshalCsvRow(row))
+	}
+	for _, row := range playsRows {
+		playsRecords = append(playsRecords, marshalCsvRow(row))
+	}
+	if err := writeParquetFiles(context.Background(), "2024-10-22", gameRecords, playsRecords); err != nil {
+		t.Fatal(err)
+	}
+
+	gamesPath := filepath.Join(cfg.Csv.ParquetDirectory, gamesParquetTable, "season=2024", "2024-10-22.parquet")
+	playsPath := filepath.Join(cfg.Csv.ParquetDirectory, playsParquetTable, "season=2024", "2024-10-22.parquet")
+	for _, path := range []string{gamesPath, playsPath} {
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("expected a parquet file in the configured directory: %v", err)
+		}
+	}
+
+	wantGames := []map[string]interface{}{{
+		"game_id": "0022400061", "season_id": "22024", "game_date": "2024-10-22", "start_time": "7:30 PM",
+		"away_team_init": "MIN", "away_team_id": 1610612750.0, "home_team_init": "LAL", "home_team_id": 1610612747.0,
+		"away_ml": 1.91, "home_ml": 1.95, "away_spread": -1.5, "home_spread": 1.5, "pregame_total": 224.5,
+		"away_final_score": 103.0, "home_final_score": 110.0, "overtime": 1.0, "overtime_periods": 1.0,
+	}}
+	checkParquetRows(t, gamesPath, wantGames)
+
+	wantPlays := []map[string]interface{}{
+		{"game_id": "0022400061", "seconds_elapsed": 0.0, "period": 1.0, "seconds_remaining": 720.0, "away_score": 0.0, "home_score": 0.0, "underdog_score": 0.0, "favorite_score": 0.0, "favorite_margin": 0.0},
+		{"game_id": "0022400061", "seconds_elapsed": 3180.0, "period": 5.0, "seconds_remaining": 0.0, "away_score": 103.0, "home_score": 110.0, "underdog_score": 110.0, "favorite_score": 103.0, "favorite_margin": -7.0},
+	}
+	checkParquetRows(t, playsPath, wantPlays)
+}
+
+/* Checks the rows decoded in go, and the rows DuckDB or pyarrow read when either is installed */
+func checkParquetRows(t *testing.T, path string, want []map[string]interface{}) {
+	t.Helper()
+	if rows := decodeParquetRows(t, path); !reflect.DeepEqual(rows, want) {
+		t.Errorf("%s decoded: got %v, want %v", filepath.Base(filepath.Dir(filepath.Dir(path))), rows, want)
+	}
+	if rows, ok := readParquetRowsExternally(t, path); !ok {
+		t.Log("no parquet reader found, install duckdb or pyarrow to also read the parquet files back with them")
+	} else if !reflect.DeepEqual(rows, want) {
+		t.Errorf("%s read back: got %v, want %v", filepath.Base(filepath.Dir(filepath.Dir(path))), rows, want)
+	}
+}
+
+/* The files follow the date's rows in the csvs, so a date left without rows has its files removed */
+func TestParquetFilesFollowCsvRows(t *testing.T) {
+	cfg := useTestConfig(t)
+	ctx := context.Background()
+	gameRecord := marshalCsvRow(GameCsv{GameId: "0022400061", SeasonId: "22024", Date: "2024-10-22"})
+	otherDateRecord := marshalCsvRow(GameCsv{GameId: "0022400062", SeasonId: "22024", Date: "2024-10-23"})
+	if err := writeParquetFiles(ctx, "2024-10-22", [][]string{gameRecord, otherDateRecord}, nil); err != nil {
+		t.Fatal(err)
+	}
+	gamesPath := filepath.Join(cfg.Csv.ParquetDirectory, gamesParquetTable, "season=2024", "2024-10-22.parquet")
+	playsPath := filepath.Join(cfg.Csv.ParquetDirectory, playsParquetTable, "season=2024", "2024-10-22.parquet")
+	for _, path := range []string{gamesPath, playsPath} {
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("expected a parquet file of the date: %v", err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(cfg.Csv.ParquetDirectory, gamesParquetTable, "season=2024", "2024-10-23.parquet")); err == nil {
+		t.Error("expected no parquet file of a date that wasn't exported")
+	}
+
+	if err := writeParquetFiles(ctx, "2024-10-22", [][]string{otherDateRecord}, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{gamesPath, playsPath} {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected the parquet file of a date without rows to be removed, got %v", err)
+		}
+	}
+}
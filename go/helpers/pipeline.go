@@ -0,0 +1,195 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/* Pipeline stages, in dependency order */
+var pipelineStages = []ProcessType{FetchRawGames, FetchRawOdds, CleanAllGames, CleanRawOdds, CombineGameWithOdds}
+
+var stageProcesses = map[ProcessType]ProcessFunc{
+	FetchRawGames:       FetchGames,
+	FetchRawOdds:        FetchOdds,
+	CleanAllGames:       CleanGames,
+	CleanRawOdds:        CleanOdds,
+	CombineGameWithOdds: CombineGamesAndOddsToCsv,
+}
+
+func PipelineProcess(stages []ProcessType) ProcessFunc {
+	return func(ctx context.Context, store Store, date string) error {
+		return runPipeline(ctx, store, date, stages)
+	}
+}
+
+/* A stage that partially succeeded still lets the later stages run for the games that succeeded */
+func runPipeline(ctx context.Context, store Store, date string, stages []ProcessType) error {
+	var partialErr error
+	for _, stage := range stages {
+		stageCtx := withLogger(ctx, loggerFrom(ctx).With("stage", string(stage)))
+		exists, err := stageOutputExists(stageCtx, store, stage, date)
+		if err != nil {
+			return fmt.Errorf("error checking output of stage %s: %w", stage, err)
+		}
+		if exists {
+			loggerFrom(stageCtx).Info("Skipping stage, output already exists")
+			recordPipelineRun(ctx, store, dateReportFrom(ctx), dateReportFrom(ctx).skipStage(stage))
+			continue
+		}
+
+		loggerFrom(stageCtx).Info("Running stage")
+		if err = runStage(stageCtx, stage, stageProcesses[stage], store, date); errors.Is(err, ErrPartialSuccess) {
+			partialErr = err
+		} else if err != nil {
+			return fmt.Errorf("stage %s failed: %w", stage, err)
+		}
+	}
+	return partialErr
+}
+
+/*
+An empty stages parameter selects every stage. Stages are named by their subcommand, ex. games clean, or
+their process name, ex. clean_games, and always run in dependency order
+*/
+func parseStages(stagesParam string) ([]ProcessType, error) {
+	if stagesParam == "" {
+		return pipelineStages, nil
+	}
+
+	selected := make(map[ProcessType]bool)
+	for _, name := range strings.Split(stagesParam, ",") {
+		cmd, err := findCommandByName(strings.TrimSpace(name))
+		if _, ok := stageProcesses[cmd.process]; err != nil || !ok {
+			return nil, errors.New("found unknown pipeline stage: " + name)
+		}
+		selected[cmd.process] = true
+	}
+
+	var stages []ProcessType
+	for _, stage := range pipelineStages {
+		if selected[stage] {
+			stages = append(stages, stage)
+		}
+	}
+	return stages, nil
+}
+
+func stageOutputExists(ctx context.Context, store Store, stage ProcessType, date string) (bool, error) {
+	switch stage {
+	case FetchRawGames:
+		return rawGamesExist(ctx, store, date)
+	case FetchRawOdds:
+		return rawOddsExist(ctx, store, date)
+	case CleanAllGames:
+		return cleanedGamesExist(ctx, store, date)
+	case CleanRawOdds:
+		return cleanedOddsExist(ctx, store, date)
+	case CombineGameWithOdds:
+		return csvRowsExist(ctx, store, date)
+	default:
+		return false, errors.New("found unknown pipeline stage: " + string(stage))
+	}
+}
+
+/* The number of games on a date is only known from the stats API, so any raw game counts */
+func rawGamesExist(ctx context.Context, store Store, date string) (bool, error) {
+	count, err := store.CountRawGames(ctx, date)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func rawOddsExist(ctx context.Context, store Store, date string) (bool, error) {
+	count, err := store.CountRawOdds(ctx, date, Config.Odds.SnapshotUtcHours)
+	if err != nil {
+		return false, err
+	}
+	return count >= int64(len(Config.Odds.SnapshotUtcHours)), nil
+}
+
+/*
+Games cleaned before a granularity was added to sampling.granularities lack its play by play, and games
+cleaned before the period column have no periods, so both are cleaned again
+*/
+func cleanedGamesExist(ctx context.Context, store Store, date string) (bool, error) {
+	rawCount, err1 := store.CountRawGames(ctx, date)
+	cleanedCount, err2 := store.CountCleanedGames(ctx, date)
+	if err1 != nil || err2 != nil {
+		return false, handleMultipleErrors(err1, err2)
+	}
+	if rawCount == 0 || cleanedCount < rawCount {
+		return false, nil
+	}
+
+	granularities, err := configuredGranularities(Config.Sampling.Granularities)
+	if err != nil {
+		return false, err
+	}
+	games, err := findCleanedGame(ctx, date, store)
+	if err != nil {
+		return false, err
+	}
+	for _, game := range games {
+		if cleanedBeforePeriods(game) {
+			return false, nil
+		}
+		for _, granularity := range granularities {
+			if _, err = game.sampledPlayByPlay(granularity.name); err != nil {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+/* Every play is in a period from 1 on, so a play in period 0 was cleaned before the period was stored and read it as 0 */
+func cleanedBeforePeriods(game CleanedGame) bool {
+	return len(game.PlayByPlay) > 0 && game.PlayByPlay[0].Period == 0
+}
+
+func cleanedOddsExist(ctx context.Context, store Store, date string) (bool, error) {
+	games, err := findCleanedGame(ctx, date, store)
+	if err != nil || len(games) == 0 {
+		return false, err
+	}
+
+	odds, err := store.FindCleanedOdds(ctx, cleanedGameIds(games))
+	if err != nil {
+		return false, err
+	}
+	return len(odds) >= len(games), nil
+}
+
+/*
+Every cleaned game needs rows in the games csv and in the plays csv of the exported granularity, so exporting
+at a new granularity writes its plays csv even though the games csv is complete. Play rows exported before
+the period column don't count, so their games are exported again
+*/
+func csvRowsExist(ctx context.Context, store Store, date string) (bool, error) {
+	games, err := findCleanedGame(ctx, date, store)
+	if err != nil || len(games) == 0 {
+		return false, err
+	}
+
+	for _, spec := range []csvSpec{gamesCsv, playsCsv} {
+		rows, err := readCsvRows(spec, spec.partitionPath(date))
+		if err != nil {
+			return false, err
+		}
+		exportedGameIds := make(map[string]bool, len(games))
+		for _, row := range rows {
+			if spec.name() != playsCsv.name() || !playsCsvRowBeforePeriods(row) {
+				exportedGameIds[spec.gameId(row)] = true
+			}
+		}
+		for _, game := range games {
+			if !exportedGameIds[game.GameId] {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,163 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+/* Funcs for the pipelineRuns ledger, one document per stage run of a date, and the status command reading it */
+func recordPipelineRun(ctx context.Context, store Store, dateReport *DateReport, stageReport *StageReport) {
+	if dateReport == nil || stageReport == nil || DryRun {
+		return
+	}
+	run := stageReport.pipelineRun(dateReport.runId, dateReport.GameDate)
+	if err := store.UpsertPipelineRun(ctx, run); err != nil {
+		loggerFrom(ctx).Warn("Failed recording pipeline run", "stage", run.Stage, "error", err)
+	}
+}
+
+func (stageReport *StageReport) pipelineRun(runId string, gameDate string) PipelineRun {
+	stageReport.mu.Lock()
+	defer stageReport.mu.Unlock()
+
+	run := PipelineRun{
+		RunId:            runId,
+		GameDate:         gameDate,
+		Stage:            stageReport.Stage,
+		Status:           stageReport.Status,
+		StartTime:        stageReport.StartTime,
+		EndTime:          stageReport.EndTime,
+		GamesFound:       stageReport.GamesFound,
+		GamesCleaned:     stageReport.GamesCleaned,
+		GamesFailed:      len(stageReport.FailedGames),
+		OddsSnapshots:    stageReport.OddsSnapshots,
+		OddsMatched:      stageReport.OddsMatched,
+		CollectionWrites: []PipelineRunCollectionWrites{},
+		CsvWrites:        []PipelineRunCsvWrites{},
+		CodeVersion:      codeVersion(),
+		Error:            stageReport.Error,
+	}
+	for collection, writes := range stageReport.Collections {
+		run.CollectionWrites = append(run.CollectionWrites, PipelineRunCollectionWrites{collection, writes.Matched, writes.Modified, writes.Upserted})
+	}
+	for csvName, writes := range stageReport.Csvs {
+		run.CsvWrites = append(run.CsvWrites, PipelineRunCsvWrites{csvName, writes.Inserted, writes.Updated, writes.Deleted})
+	}
+	sort.Slice(run.CollectionWrites, func(i, j int) bool { return run.CollectionWrites[i].Collection < run.CollectionWrites[j].Collection })
+	sort.Slice(run.CsvWrites, func(i, j int) bool { return run.CsvWrites[i].Csv < run.CsvWrites[j].Csv })
+	return run
+}
+
+/* The vcs revision go build embeds, marked dirty when built with uncommitted changes */
+func codeVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	var revision, modified string
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = ternaryOperator(setting.Value == "true", "-dirty", "")
+		}
+	}
+	if revision == "" {
+		return info.Main.Version
+	}
+	return revision + modified
+}
+
+/* Prints the latest status of every pipeline stage for every date, to spot holes in the data */
+func PrintStatus(dates []string) (err error) {
+	store, err := newStore(*Config)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err1 := store.Close(context.TODO()); err == nil {
+			err = err1
+		}
+	}()
+
+	latestStatuses, err := findLatestStageStatuses(context.Background(), dates, store)
+	if err != nil {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := []string{"date"}
+	for _, stage := range pipelineStages {
+		header = append(header, string(stage))
+	}
+	fmt.Fprintln(writer, strings.Join(header, "\t"))
+
+	var numComplete int
+	for _, date := range dates {
+		row := []string{date}
+		complete := true
+		for _, stage := range pipelineStages {
+			status := latestStatuses[date][string(stage)]
+			complete = complete && (status == statusSuccess || status == statusSkipped)
+			row = append(row, describeStageStatus(status))
+		}
+		if complete {
+			numComplete += 1
+		}
+		fmt.Fprintln(writer, strings.Join(row, "\t"))
+	}
+	if err = writer.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("\n%d of %d dates complete\n", numComplete, len(dates))
+	return nil
+}
+
+/* Returns the status of the latest run of each stage, by date */
+func findLatestStageStatuses(ctx context.Context, dates []string, store Store) (map[string]map[string]string, error) {
+	runs, err := store.FindPipelineRuns(ctx, dates)
+	if err != nil {
+		return nil, err
+	}
+
+	latestStatuses := make(map[string]map[string]string)
+	for _, run := range runs {
+		if _, ok := latestStatuses[run.GameDate]; !ok {
+			latestStatuses[run.GameDate] = make(map[string]string)
+		}
+		latestStatuses[run.GameDate][run.Stage] = run.Status
+	}
+	return latestStatuses, nil
+}
+
+/* A skipped stage found its output already written, so it counts as done */
+func describeStageStatus(status string) string {
+	switch status {
+	case statusSuccess, statusSkipped:
+		return "ok"
+	case statusPartialSuccess:
+		return "partial"
+	case statusFailure:
+		return "FAILED"
+	case "":
+		return "-"
+	default:
+		return status
+	}
+}
+
+func pipelineRunFilter(runId string, gameDate string, stage string) bson.M {
+	return bson.M{
+		"runId":    runId,
+		"gameDate": gameDate,
+		"stage":    stage,
+	}
+}
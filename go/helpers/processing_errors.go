@@ -0,0 +1,84 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+/* Returned, wrapped, when some games of a date failed in lenient mode and the rest were written */
+var ErrPartialSuccess = errors.New("partial success")
+
+type gameOutcome[R any] struct {
+	result  R
+	failure *ProcessingError
+}
+
+/*
+Runs fn for every game on the worker pool. In lenient mode a failing game is recorded and
+skipped instead of failing the whole date. Results and failures keep the order of the games
+*/
+func processGames[T any, R any](ctx context.Context, process ProcessType, date string, games []T, gameId func(T) string,
+	fn func(context.Context, T) (R, error)) (results []R, failures []ProcessingError, err error) {
+
+	outcomes, err := runWorkerPool(ctx, Workers, games, func(ctx context.Context, game T) (gameOutcome[R], error) {
+		ctx = withGameId(ctx, gameId(game))
+		result, err := fn(ctx, game)
+		if err != nil && Lenient && ctx.Err() == nil {
+			loggerFrom(ctx).Warn("Failed processing game, continuing", "error", err)
+			return gameOutcome[R]{failure: &ProcessingError{
+				GameId:     gameId(game),
+				Date:       date,
+				Process:    string(process),
+				Reason:     err.Error(),
+				RecordedAt: time.Now().UTC().Format(time.RFC3339),
+			}}, nil
+		}
+		return gameOutcome[R]{result: result}, err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, outcome := range outcomes {
+		if outcome.failure != nil {
+			failures = append(failures, *outcome.failure)
+		} else {
+			results = append(results, outcome.result)
+		}
+	}
+	stageReportFrom(ctx).recordFailedGames(failures)
+	gamesProcessed.add(float64(len(games)), string(process))
+	gamesFailed.add(float64(len(failures)), string(process))
+	return results, failures, nil
+}
+
+/* Stores the failures of a run and clears earlier failures of the games that now succeeded */
+func recordProcessingErrors(ctx context.Context, store Store, process ProcessType, failures []ProcessingError, succeededGameIds []string) error {
+	if len(failures) > 0 {
+		if err := store.UpsertProcessingErrors(ctx, failures); err != nil {
+			return err
+		}
+	}
+
+	if len(succeededGameIds) > 0 && !DryRun {
+		if err := store.DeleteProcessingErrors(ctx, process, succeededGameIds); err != nil {
+			return err
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%w: %d game(s) failed %s", ErrPartialSuccess, len(failures), process)
+	}
+	return nil
+}
+
+func processingErrorFilter(gameId string, process ProcessType) bson.M {
+	return bson.M{
+		"gameId":  gameId,
+		"process": string(process),
+	}
+}
@@ -0,0 +1,222 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+/* Funcs for building the json run report. Recorders are safe to call with a nil stage report */
+type dateReportContextKey struct{}
+type stageReportContextKey struct{}
+
+const (
+	statusRunning        = "running"
+	statusSuccess        = "success"
+	statusPartialSuccess = "partial_success"
+	statusFailure        = "failure"
+	statusSkipped        = "skipped"
+)
+
+func newRunReport(options *RunOptions) *RunReport {
+	return &RunReport{
+		RunId:     options.RunId,
+		Process:   options.ProcessName,
+		DryRun:    DryRun,
+		StartTime: timestampNow(),
+		GameDates: ternaryOperator(options.Dates == nil, []string{}, options.Dates),
+		Settings:  newRunSettings(*Config),
+		Dates:     []*DateReport{},
+		Errors:    []string{},
+	}
+}
+
+func newRunSettings(config NbaConfig) RunSettings {
+	return RunSettings{
+		Odds:               config.Odds,
+		HistoricalOddsPath: config.OddsApi.HistoricalOddsPath,
+		Csv:                config.Csv,
+		Collections:        config.Collections,
+		Sampling:           config.Sampling,
+		LogPath:            config.Logging.Path,
+	}
+}
+
+func (report *RunReport) addDate(date string) *DateReport {
+	dateReport := &DateReport{runId: report.RunId, GameDate: date, Stages: []*StageReport{}}
+	report.Dates = append(report.Dates, dateReport)
+	return dateReport
+}
+
+func (report *RunReport) finish(err error) {
+	report.EndTime = timestampNow()
+	report.Status = statusForError(err)
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	}
+}
+
+func (dateReport *DateReport) addStage(stage ProcessType, status string) *StageReport {
+	if dateReport == nil {
+		return nil
+	}
+	stageReport := &StageReport{Stage: string(stage), Status: status, StartTime: timestampNow()}
+	dateReport.Stages = append(dateReport.Stages, stageReport)
+	return stageReport
+}
+
+/* A skipped stage starts and ends at once */
+func (dateReport *DateReport) skipStage(stage ProcessType) *StageReport {
+	stageReport := dateReport.addStage(stage, statusSkipped)
+	if stageReport != nil {
+		stageReport.EndTime = stageReport.StartTime
+	}
+	return stageReport
+}
+
+func (dateReport *DateReport) finish(err error) {
+	dateReport.Status = statusForError(err)
+	if err != nil {
+		dateReport.Error = err.Error()
+	}
+}
+
+func (stageReport *StageReport) finish(err error) {
+	if stageReport == nil {
+		return
+	}
+	stageReport.mu.Lock()
+	defer stageReport.mu.Unlock()
+	stageReport.EndTime = timestampNow()
+	stageReport.Status = statusForError(err)
+	if err != nil {
+		stageReport.Error = err.Error()
+	}
+}
+
+func (stageReport *StageReport) recordGamesFound(count int) {
+	stageReport.update(func() { stageReport.GamesFound = count })
+}
+
+func (stageReport *StageReport) recordGamesCleaned(count int) {
+	stageReport.update(func() { stageReport.GamesCleaned = count })
+}
+
+func (stageReport *StageReport) recordOddsSnapshots(count int) {
+	stageReport.update(func() { stageReport.OddsSnapshots = count })
+}
+
+func (stageReport *StageReport) recordOddsMatched(odds []CleanedOdds) {
+	stageReport.update(func() {
+		stageReport.OddsMatched = len(odds)
+		stageReport.Bookmakers = make(map[string]string, len(odds))
+		for _, gameOdds := range odds {
+			stageReport.Bookmakers[gameOdds.GameId] = gameOdds.Bookmaker
+		}
+	})
+}
+
+func (stageReport *StageReport) recordFailedGames(failures []ProcessingError) {
+	stageReport.update(func() { stageReport.FailedGames = append(stageReport.FailedGames, failures...) })
+}
+
+func (stageReport *StageReport) recordCollectionWrites(collection string, matched int64, modified int64, upserted int64) {
+	stageReport.update(func() {
+		if stageReport.Collections == nil {
+			stageReport.Collections = make(map[string]*CollectionWrites)
+		}
+		writes, ok := stageReport.Collections[collection]
+		if !ok {
+			writes = &CollectionWrites{}
+			stageReport.Collections[collection] = writes
+		}
+		writes.Matched += matched
+		writes.Modified += modified
+		writes.Upserted += upserted
+	})
+}
+
+func (stageReport *StageReport) recordCsvWrites(csvName string, inserted int, updated int, deleted int) {
+	stageReport.update(func() {
+		if stageReport.Csvs == nil {
+			stageReport.Csvs = make(map[string]*CsvWrites)
+		}
+		writes, ok := stageReport.Csvs[csvName]
+		if !ok {
+			writes = &CsvWrites{}
+			stageReport.Csvs[csvName] = writes
+		}
+		writes.Inserted += inserted
+		writes.Updated += updated
+		writes.Deleted += deleted
+	})
+}
+
+func (stageReport *StageReport) update(apply func()) {
+	if stageReport == nil {
+		return
+	}
+	stageReport.mu.Lock()
+	defer stageReport.mu.Unlock()
+	apply()
+}
+
+func withDateReport(ctx context.Context, dateReport *DateReport) context.Context {
+	return context.WithValue(ctx, dateReportContextKey{}, dateReport)
+}
+
+func dateReportFrom(ctx context.Context) *DateReport {
+	dateReport, _ := ctx.Value(dateReportContextKey{}).(*DateReport)
+	return dateReport
+}
+
+func withStageReport(ctx context.Context, stageReport *StageReport) context.Context {
+	return context.WithValue(ctx, stageReportContextKey{}, stageReport)
+}
+
+func stageReportFrom(ctx context.Context) *StageReport {
+	stageReport, _ := ctx.Value(stageReportContextKey{}).(*StageReport)
+	return stageReport
+}
+
+func writeRunReport(report *RunReport, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	contents, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(path, contents, 0644); err != nil {
+		return err
+	}
+	Logger.Info("Wrote run report", "path", path)
+	return nil
+}
+
+/* Defaults to one file per run in the configured report directory */
+func runReportPath(options *RunOptions) string {
+	if options.ReportPath != "" {
+		return options.ReportPath
+	}
+	fileName := options.ProcessName + "_" + time.Now().UTC().Format("20060102T150405Z") + "_" + options.RunId + ".json"
+	return filepath.Join(Config.Report.Directory, fileName)
+}
+
+func statusForError(err error) string {
+	switch {
+	case err == nil:
+		return statusSuccess
+	case errors.Is(err, ErrPartialSuccess):
+		return statusPartialSuccess
+	default:
+		return statusFailure
+	}
+}
+
+func timestampNow() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
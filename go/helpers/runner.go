@@ -0,0 +1,132 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+/* Signature shared by every process, run once per game date */
+type ProcessFunc func(ctx context.Context, store Store, date string) error
+
+func RunForDates(process ProcessFunc, options *RunOptions) (err error) {
+	report := newRunReport(options)
+	startTime := time.Now()
+	defer func() {
+		r := recover()
+		if r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+		finishRunReport(report, options, err)
+		recordRunMetrics(time.Since(startTime), err)
+		if err1 := writeMetricsTextfile(Config.Metrics.TextfileDirectory); err1 != nil {
+			Logger.Error("Failed writing metrics textfile", "error", err1)
+		}
+		if r != nil {
+			panic(r)
+		}
+	}()
+
+	store, err := newStore(*Config)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err1 := store.Close(context.TODO()); err == nil {
+			err = err1
+		}
+	}()
+
+	runCtx := context.Background()
+	if options.RunId != processRunId {
+		runCtx = withLogger(runCtx, Logger.With("stageRunId", options.RunId))
+	}
+
+	dates := options.Dates
+	var succeededDates, partialDates, failedDates []string
+	for i, date := range dates {
+		dateReport := report.addDate(date)
+		ctx := withDateReport(withGameDate(runCtx, date), dateReport)
+		loggerFrom(ctx).Info("Processing date", "progress", fmt.Sprintf("%d/%d", i+1, len(dates)))
+
+		var err2 error
+		if processType := ProcessType(options.ProcessName); processType == RunPipeline {
+			err2 = process(ctx, store, date)
+		} else {
+			err2 = runStage(ctx, processType, process, store, date)
+		}
+		dateReport.finish(err2)
+
+		if errors.Is(err2, ErrPartialSuccess) {
+			loggerFrom(ctx).Warn("Partially processed date", "error", err2)
+			partialDates = append(partialDates, date)
+		} else if err2 != nil {
+			loggerFrom(ctx).Error("Failed processing date", "error", err2)
+			failedDates = append(failedDates, date)
+		} else {
+			succeededDates = append(succeededDates, date)
+		}
+	}
+
+	logRunSummary(runCtx, dates, succeededDates, partialDates, failedDates)
+	if len(failedDates) > 0 {
+		return fmt.Errorf("%d of %d dates failed", len(failedDates), len(dates))
+	}
+	if len(partialDates) > 0 {
+		return fmt.Errorf("%w: %d of %d dates had failed games", ErrPartialSuccess, len(partialDates), len(dates))
+	}
+	return nil
+}
+
+/*
+Runs a process without game dates, ex. db migrate, export concat or export dictionary, under a run report of
+its own. serve writes a report for every stage it runs, and status and config show only read, so they write none
+*/
+func RunCommand(process func() error, options *RunOptions) (err error) {
+	report := newRunReport(options)
+	defer func() {
+		r := recover()
+		if r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+		finishRunReport(report, options, err)
+		if r != nil {
+			panic(r)
+		}
+	}()
+	return process()
+}
+
+func finishRunReport(report *RunReport, options *RunOptions, err error) {
+	report.finish(err)
+	if err1 := writeRunReport(report, runReportPath(options)); err1 != nil {
+		Logger.Error("Failed writing run report", "error", err1)
+	}
+}
+
+/* Runs one stage for a date under its locks, recording its outcome in a new stage report */
+func runStage(ctx context.Context, stage ProcessType, process ProcessFunc, store Store, date string) error {
+	dateReport := dateReportFrom(ctx)
+	stageReport := dateReport.addStage(stage, statusRunning)
+	startTime := time.Now()
+	err := withLeases(ctx, stageLeases(store, stage, date, dateReport.runId), func(ctx context.Context) error {
+		return process(withStageReport(ctx, stageReport), store, date)
+	})
+	stageReport.finish(err)
+	recordStageMetrics(stage, time.Since(startTime), err)
+	recordPipelineRun(ctx, store, dateReport, stageReport)
+	return err
+}
+
+func logRunSummary(ctx context.Context, dates []string, succeededDates []string, partialDates []string, failedDates []string) {
+	loggerFrom(ctx).Info("Run summary",
+		"gameDates", describeDates(dates),
+		"succeeded", len(succeededDates),
+		"partiallySucceeded", len(partialDates),
+		"failed", len(failedDates),
+		"succeededDates", strings.Join(succeededDates, ","),
+		"partiallySucceededDates", strings.Join(partialDates, ","),
+		"failedDates", strings.Join(failedDates, ","))
+}
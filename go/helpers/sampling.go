@@ -0,0 +1,118 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+/*
+Granularities the cleaned play by play is sampled at. A granularity is written as <interval> to sample
+the whole game, ex. 30s, or as <interval>/final<window> to only sample the end of every period, ex.
+5s/final3m for every 5 seconds of the final 3 minutes of each quarter and overtime period. The 30 second whole game sampling
+is always kept in CleanedGame.PlayByPlay, and the configured ones beside it in CleanedGame.Samplings
+*/
+type samplingGranularity struct {
+	name        string
+	interval    int32
+	finalWindow int32
+}
+
+/* Score after a play, at the seconds elapsed of the play */
+type scoredPlay struct {
+	secondsElapsed int32
+	awayScore      int
+	homeScore      int
+}
+
+func parseGranularity(name string) (samplingGranularity, error) {
+	intervalPart, windowPart, windowed := strings.Cut(name, "/")
+	interval, err := time.ParseDuration(intervalPart)
+	if err != nil || interval < time.Second || interval%time.Second != 0 {
+		return samplingGranularity{}, fmt.Errorf("granularity %q must start with a whole number of seconds, ex. 30s or 5s/final3m", name)
+	}
+	granularity := samplingGranularity{name: name, interval: int32(interval.Seconds())}
+	if !windowed {
+		return granularity, nil
+	}
+
+	window, err := time.ParseDuration(strings.TrimPrefix(windowPart, "final"))
+	if !strings.HasPrefix(windowPart, "final") || err != nil || window < interval || window%time.Second != 0 {
+		return samplingGranularity{}, fmt.Errorf("granularity %q must end with /final and a window of whole seconds no shorter than the interval, ex. 5s/final3m", name)
+	}
+	if window > time.Duration(quarterSeconds)*time.Second {
+		return samplingGranularity{}, fmt.Errorf("granularity %q has a window longer than a quarter", name)
+	}
+	granularity.finalWindow = int32(window.Seconds())
+	return granularity, nil
+}
+
+/* Samples at the start of a period belong to the end of the previous one */
+func (granularity samplingGranularity) includes(secondsElapsed int32) bool {
+	if granularity.finalWindow == 0 {
+		return true
+	}
+	_, secondsRemaining := periodAtSecondsElapsed(secondsElapsed)
+	return secondsElapsed > 0 && secondsRemaining <= granularity.finalWindow
+}
+
+/* Each sample has the score of the first play at or after it, so a sample falling between plays waits for the next one */
+func samplePlayByPlay(plays []scoredPlay, granularity samplingGranularity) (playByPlay []PlayByPlay) {
+	var nextSample int32
+	for _, play := range plays {
+		for ; nextSample <= play.secondsElapsed; nextSample += granularity.interval {
+			if granularity.includes(nextSample) {
+				period, secondsRemaining := periodAtSecondsElapsed(nextSample)
+				playByPlay = append(playByPlay, PlayByPlay{
+					SecondsElapsed:   nextSample,
+					Period:           period,
+					SecondsRemaining: secondsRemaining,
+					AwayScore:        play.awayScore,
+					HomeScore:        play.homeScore,
+				})
+			}
+		}
+	}
+	return playByPlay
+}
+
+/* The configured granularities besides the default one, which is always sampled */
+func configuredGranularities(names []string) ([]samplingGranularity, error) {
+	var granularities []samplingGranularity
+	for _, name := range names {
+		if name == defaultGranularity {
+			continue
+		}
+		granularity, err := parseGranularity(name)
+		if err != nil {
+			return nil, err
+		}
+		granularities = append(granularities, granularity)
+	}
+	return granularities, nil
+}
+
+func (game CleanedGame) sampledPlayByPlay(granularity string) ([]PlayByPlay, error) {
+	if granularity == defaultGranularity {
+		return game.PlayByPlay, nil
+	}
+	for _, sampling := range game.Samplings {
+		if sampling.Granularity == granularity {
+			return sampling.PlayByPlay, nil
+		}
+	}
+	return nil, errors.New("game " + game.GameId + " has no " + granularity + " play by play, rerun games clean with it in sampling.granularities")
+}
+
+/* Exports at other granularities get their own files, ex. game_play_by_play_data_5s_final3m.csv, so rows of two granularities never mix */
+func granularityFileName(fileName string, granularity string) string {
+	if granularity == defaultGranularity {
+		return fileName
+	}
+	extension := ""
+	if i := strings.LastIndex(fileName, "."); i >= 0 {
+		fileName, extension = fileName[:i], fileName[i:]
+	}
+	return fileName + "_" + strings.ReplaceAll(granularity, "/", "_") + extension
+}
@@ -0,0 +1,242 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"time"
+)
+
+/*
+Runs the pipeline stages nightly on a cron schedule, as an alternative to the airflow DAG. Failed
+stages are retried after a delay, and the state of the current run is persisted after every step,
+so a restarted scheduler resumes the run instead of starting over
+*/
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+type scheduler struct {
+	clock      Clock
+	schedule   *cronSchedule
+	location   *time.Location
+	stages     []ProcessType
+	lagDays    int
+	retries    int
+	retryDelay time.Duration
+	statePath  string
+	runStage   func(stage ProcessType, date string, runId string) error
+}
+
+func RunScheduler(options *RunOptions) error {
+	schedule, err := parseCronSchedule(options.Schedule)
+	if err != nil {
+		return err
+	}
+	location, err := time.LoadLocation(timezoneEstName)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s := &scheduler{
+		clock:      systemClock{},
+		schedule:   schedule,
+		location:   location,
+		stages:     options.Stages,
+		lagDays:    options.LagDays,
+		retries:    Config.Scheduler.Retries,
+		retryDelay: Config.Scheduler.RetryDelay,
+		statePath:  Config.Scheduler.StateFile,
+		runStage: func(stage ProcessType, date string, runId string) error {
+			return RunForDates(stageProcesses[stage], &RunOptions{
+				ProcessName: string(stage),
+				RunId:       runId,
+				Dates:       []string{date},
+			})
+		},
+	}
+	return s.run(ctx)
+}
+
+/* Returns nil once the context is cancelled. A stage already running is finished first */
+func (s *scheduler) run(ctx context.Context) error {
+	state, err := loadSchedulerState(s.statePath)
+	if err != nil {
+		return err
+	}
+	if state.PendingRun != nil {
+		Logger.Info("Resuming scheduled run", "gameDate", state.PendingRun.GameDate, "scheduledTime", state.PendingRun.ScheduledTime)
+	}
+
+	for {
+		if state.PendingRun == nil {
+			scheduledTime, err := s.nextScheduledTime(state)
+			if err != nil {
+				return err
+			}
+			Logger.Info("Waiting for next scheduled run", "scheduledTime", scheduledTime.Format(time.RFC3339))
+			if err = s.sleepUntil(ctx, scheduledTime); err != nil {
+				break
+			}
+
+			state.LastScheduledTime = scheduledTime.Format(time.RFC3339)
+			state.PendingRun = &scheduledRun{
+				ScheduledTime:   scheduledTime.Format(time.RFC3339),
+				GameDate:        gameDateToday(scheduledTime).AddDate(0, 0, -s.lagDays).Format(dateLayout),
+				CompletedStages: []string{},
+			}
+			if err = saveSchedulerState(s.statePath, state); err != nil {
+				return err
+			}
+		}
+
+		if err := s.resumeRun(ctx, state); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	Logger.Info("Stopping scheduler")
+	return nil
+}
+
+/* Like the DAG without catchup, only the latest run missed while the scheduler was down is made up */
+func (s *scheduler) nextScheduledTime(state *schedulerState) (time.Time, error) {
+	now := s.clock.Now().In(s.location)
+	if state.LastScheduledTime == "" {
+		return s.schedule.next(now)
+	}
+
+	lastScheduledTime, err := time.Parse(time.RFC3339, state.LastScheduledTime)
+	if err != nil {
+		return time.Time{}, errors.New("invalid last scheduled time in scheduler state: " + state.LastScheduledTime)
+	}
+	scheduledTime, err := s.schedule.next(lastScheduledTime.In(s.location))
+	for err == nil {
+		following, err1 := s.schedule.next(scheduledTime)
+		if err1 != nil || following.After(now) {
+			break
+		}
+		scheduledTime = following
+	}
+	return scheduledTime, err
+}
+
+/*
+Runs the stages not completed yet. A partially successful stage counts as completed, as in the DAG. Every
+attempt gets a run id of its own, so its run report, log lines and pipelineRuns records stay apart
+*/
+func (s *scheduler) resumeRun(ctx context.Context, state *schedulerState) error {
+	run := state.PendingRun
+	logger := Logger.With("gameDate", run.GameDate, "scheduledTime", run.ScheduledTime)
+
+	for _, stage := range s.stages {
+		if slices.Contains(run.CompletedStages, string(stage)) {
+			continue
+		}
+
+		for {
+			if run.NextAttemptTime != "" {
+				nextAttemptTime, err := time.Parse(time.RFC3339, run.NextAttemptTime)
+				if err != nil {
+					return errors.New("invalid next attempt time in scheduler state: " + run.NextAttemptTime)
+				}
+				if err = s.sleepUntil(ctx, nextAttemptTime); err != nil {
+					return nil
+				}
+			} else if ctx.Err() != nil {
+				return nil
+			}
+
+			stageRunId := newRunId()
+			logger.Info("Running scheduled stage", "stage", string(stage), "attempt", run.Attempts+1, "stageRunId", stageRunId)
+			err := s.runStage(stage, run.GameDate, stageRunId)
+			if err == nil || errors.Is(err, ErrPartialSuccess) {
+				break
+			}
+
+			run.Attempts += 1
+			if run.Attempts > s.retries {
+				logger.Error("Scheduled stage failed, skipping the run until the next schedule", "stage", string(stage), "attempts", run.Attempts, "error", err)
+				state.PendingRun = nil
+				return saveSchedulerState(s.statePath, state)
+			}
+			run.NextAttemptTime = s.clock.Now().Add(s.retryDelay).Format(time.RFC3339)
+			logger.Warn("Scheduled stage failed, retrying", "stage", string(stage), "attempts", run.Attempts, "nextAttemptTime", run.NextAttemptTime, "error", err)
+			if err = saveSchedulerState(s.statePath, state); err != nil {
+				return err
+			}
+		}
+
+		run.CompletedStages = append(run.CompletedStages, string(stage))
+		run.Attempts, run.NextAttemptTime = 0, ""
+		if err := saveSchedulerState(s.statePath, state); err != nil {
+			return err
+		}
+	}
+
+	logger.Info("Finished scheduled run")
+	state.PendingRun = nil
+	return saveSchedulerState(s.statePath, state)
+}
+
+func (s *scheduler) sleepUntil(ctx context.Context, t time.Time) error {
+	if wait := t.Sub(s.clock.Now()); wait > 0 {
+		select {
+		case <-ctx.Done():
+		case <-s.clock.After(wait):
+		}
+	}
+	return ctx.Err()
+}
+
+func loadSchedulerState(path string) (*schedulerState, error) {
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &schedulerState{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var state schedulerState
+	if err = json.Unmarshal(contents, &state); err != nil {
+		return nil, errors.New("error reading scheduler state file: " + path)
+	}
+	return &state, nil
+}
+
+/* Written atomically, so a crash never leaves a half written state file */
+func saveSchedulerState(path string, state *schedulerState) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	contents, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(path, func(w io.Writer) error {
+		_, err := w.Write(contents)
+		return err
+	})
+}
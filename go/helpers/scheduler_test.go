@@ -0,0 +1,327 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+/* Sleeping on the fake clock moves it forward at once, and the sleeps are recorded */
+type fakeClock struct {
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+type stageAttempt struct {
+	stage ProcessType
+	date  string
+	runId string
+	time  time.Time
+}
+
+/* Fails the given stage on its first failures attempts, and stops the scheduler after the last stage succeeds */
+type fakeStages struct {
+	clock    *fakeClock
+	stages   []ProcessType
+	failing  ProcessType
+	failures int
+	attempts []stageAttempt
+	stop     context.CancelFunc
+}
+
+func (f *fakeStages) runStage(stage ProcessType, date string, runId string) error {
+	f.attempts = append(f.attempts, stageAttempt{stage, date, runId, f.clock.now})
+	if stage == f.failing && f.failures > 0 {
+		f.failures -= 1
+		return errors.New("stage failed")
+	}
+	if stage == f.stages[len(f.stages)-1] {
+		f.stop()
+	}
+	return nil
+}
+
+func newTestScheduler(t *testing.T, now time.Time, failing ProcessType, failures int) (*scheduler, *fakeStages, context.Context) {
+	t.Helper()
+	schedule, err := parseCronSchedule("0 6 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	location, err := time.LoadLocation(timezoneEstName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	t.Cleanup(stop)
+	clock := &fakeClock{now: now}
+	stages := &fakeStages{
+		clock:    clock,
+		stages:   []ProcessType{FetchRawGames, CleanAllGames, CombineGameWithOdds},
+		failing:  failing,
+		failures: failures,
+		stop:     stop,
+	}
+	s := &scheduler{
+		clock:      clock,
+		schedule:   schedule,
+		location:   location,
+		stages:     stages.stages,
+		lagDays:    2,
+		retries:    3,
+		retryDelay: 5 * time.Minute,
+		statePath:  filepath.Join(t.TempDir(), "scheduler_state.json"),
+		runStage:   stages.runStage,
+	}
+	return s, stages, ctx
+}
+
+func estTime(t *testing.T, value string) time.Time {
+	t.Helper()
+	location, err := time.LoadLocation(timezoneEstName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := time.ParseInLocation("2006-01-02 15:04", value, location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func attemptedStages(attempts []stageAttempt) []ProcessType {
+	stages := make([]ProcessType, len(attempts))
+	for i, attempt := range attempts {
+		stages[i] = attempt.stage
+	}
+	return stages
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	tests := []struct {
+		schedule string
+		after    string
+		want     string
+	}{
+		{"0 6 * * *", "2024-10-22 05:59", "2024-10-22 06:00"},
+		{"0 6 * * *", "2024-10-22 06:00", "2024-10-23 06:00"},
+		{"30 6 * * 1-5", "2024-10-25 07:00", "2024-10-28 06:30"},
+		{"*/15 * * * *", "2024-10-22 06:07", "2024-10-22 06:15"},
+		{"0 0 1 * *", "2024-12-15 00:00", "2025-01-01 00:00"},
+		{"0 6 15 * 0", "2024-10-14 07:00", "2024-10-15 06:00"},
+		{"0 6 15 * 0", "2024-10-15 07:00", "2024-10-20 06:00"},
+		{"0 6 29 2 *", "2024-03-01 00:00", "2028-02-29 06:00"},
+	}
+	for _, test := range tests {
+		schedule, err := parseCronSchedule(test.schedule)
+		if err != nil {
+			t.Fatalf("%s: %v", test.schedule, err)
+		}
+		got, err := schedule.next(estTime(t, test.after))
+		if err != nil {
+			t.Fatalf("%s after %s: %v", test.schedule, test.after, err)
+		}
+		if want := estTime(t, test.want); !got.Equal(want) {
+			t.Errorf("%s after %s: got %s, want %s", test.schedule, test.after, got, want)
+		}
+	}
+}
+
+func TestCronScheduleRejectsInvalidSchedules(t *testing.T) {
+	for _, expression := range []string{"0 6 * *", "60 6 * * *", "0 24 * * *", "0 6 0 * *", "0 6 * * 8", "*/0 6 * * *", "5-1 6 * * *"} {
+		if _, err := parseCronSchedule(expression); err == nil {
+			t.Errorf("%s: expected an error", expression)
+		}
+	}
+
+	schedule, err := parseCronSchedule("0 6 31 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = schedule.next(estTime(t, "2024-10-22 06:00")); err == nil {
+		t.Error("0 6 31 2 *: expected a schedule that never matches to fail")
+	}
+}
+
+func TestSchedulerNextScheduledTime(t *testing.T) {
+	tests := []struct {
+		name              string
+		lastScheduledTime string
+		now               string
+		want              string
+	}{
+		{"first run", "", "2024-10-22 07:00", "2024-10-23 06:00"},
+		{"next run", "2024-10-22 06:00", "2024-10-22 07:00", "2024-10-23 06:00"},
+		{"missed run", "2024-10-22 06:00", "2024-10-23 12:00", "2024-10-23 06:00"},
+		{"only latest missed run", "2024-10-19 06:00", "2024-10-23 12:00", "2024-10-23 06:00"},
+	}
+	for _, test := range tests {
+		s, _, _ := newTestScheduler(t, estTime(t, test.now), "", 0)
+		state := &schedulerState{}
+		if test.lastScheduledTime != "" {
+			state.LastScheduledTime = estTime(t, test.lastScheduledTime).Format(time.RFC3339)
+		}
+		got, err := s.nextScheduledTime(state)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if want := estTime(t, test.want); !got.Equal(want) {
+			t.Errorf("%s: got %s, want %s", test.name, got, want)
+		}
+	}
+}
+
+func TestSchedulerWaitsForScheduleAndRunsStages(t *testing.T) {
+	s, stages, ctx := newTestScheduler(t, estTime(t, "2024-10-24 05:00"), "", 0)
+	if err := s.run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(stages.clock.sleeps, []time.Duration{time.Hour}) {
+		t.Errorf("sleeps: got %v, want [1h]", stages.clock.sleeps)
+	}
+	if got := attemptedStages(stages.attempts); !slices.Equal(got, s.stages) {
+		t.Errorf("stages: got %v, want %v", got, s.stages)
+	}
+	for _, attempt := range stages.attempts {
+		if attempt.date != "2024-10-22" {
+			t.Errorf("%s: got game date %s, want 2024-10-22", attempt.stage, attempt.date)
+		}
+	}
+
+	state, err := loadSchedulerState(s.statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.PendingRun != nil {
+		t.Errorf("expected no pending run after a finished run, got %+v", state.PendingRun)
+	}
+	if want := estTime(t, "2024-10-24 06:00").Format(time.RFC3339); state.LastScheduledTime != want {
+		t.Errorf("last scheduled time: got %s, want %s", state.LastScheduledTime, want)
+	}
+}
+
+func TestSchedulerCatchesUpLatestMissedRunOnStartup(t *testing.T) {
+	s, stages, ctx := newTestScheduler(t, estTime(t, "2024-10-24 12:00"), "", 0)
+	state := &schedulerState{LastScheduledTime: estTime(t, "2024-10-20 06:00").Format(time.RFC3339)}
+	if err := saveSchedulerState(s.statePath, state); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stages.clock.sleeps) != 0 {
+		t.Errorf("expected the missed run to start at once, slept %v", stages.clock.sleeps)
+	}
+	if got := attemptedStages(stages.attempts); !slices.Equal(got, s.stages) {
+		t.Errorf("expected only the latest missed run, got stages %v", got)
+	}
+	if date := stages.attempts[0].date; date != "2024-10-22" {
+		t.Errorf("got game date %s, want 2024-10-22", date)
+	}
+}
+
+func TestSchedulerRetriesFailedStageAfterDelay(t *testing.T) {
+	s, stages, ctx := newTestScheduler(t, estTime(t, "2024-10-24 06:00"), CleanAllGames, 2)
+	s.retryDelay = 10 * time.Minute
+	state := &schedulerState{
+		LastScheduledTime: estTime(t, "2024-10-24 06:00").Format(time.RFC3339),
+		PendingRun:        &scheduledRun{ScheduledTime: estTime(t, "2024-10-24 06:00").Format(time.RFC3339), GameDate: "2024-10-22", CompletedStages: []string{}},
+	}
+	if err := saveSchedulerState(s.statePath, state); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ProcessType{FetchRawGames, CleanAllGames, CleanAllGames, CleanAllGames, CombineGameWithOdds}
+	if got := attemptedStages(stages.attempts); !slices.Equal(got, want) {
+		t.Fatalf("stages: got %v, want %v", got, want)
+	}
+	for i := 2; i <= 3; i++ {
+		if wait := stages.attempts[i].time.Sub(stages.attempts[i-1].time); wait != s.retryDelay {
+			t.Errorf("retry %d: waited %s, want %s", i-1, wait, s.retryDelay)
+		}
+	}
+
+	runIds := map[string]bool{}
+	for _, attempt := range stages.attempts {
+		if attempt.runId == "" || runIds[attempt.runId] {
+			t.Errorf("expected a new run id per attempt, got %q again", attempt.runId)
+		}
+		runIds[attempt.runId] = true
+	}
+}
+
+func TestSchedulerSkipsRunAfterRetries(t *testing.T) {
+	for _, retries := range []int{0, 1} {
+		s, stages, ctx := newTestScheduler(t, estTime(t, "2024-10-24 06:00"), CleanAllGames, 10)
+		s.retries = retries
+		state := &schedulerState{
+			PendingRun: &scheduledRun{ScheduledTime: estTime(t, "2024-10-24 06:00").Format(time.RFC3339), GameDate: "2024-10-22", CompletedStages: []string{}},
+		}
+		if err := s.resumeRun(ctx, state); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []ProcessType{FetchRawGames}
+		for i := 0; i <= retries; i++ {
+			want = append(want, CleanAllGames)
+		}
+		if got := attemptedStages(stages.attempts); !slices.Equal(got, want) {
+			t.Errorf("%d retries: got stages %v, want %v", retries, got, want)
+		}
+		saved, err := loadSchedulerState(s.statePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved.PendingRun != nil {
+			t.Errorf("%d retries: expected the failed run to be dropped, got %+v", retries, saved.PendingRun)
+		}
+	}
+}
+
+func TestSchedulerResumesPendingRunAfterRestart(t *testing.T) {
+	s, stages, ctx := newTestScheduler(t, estTime(t, "2024-10-24 06:20"), "", 0)
+	state := &schedulerState{
+		LastScheduledTime: estTime(t, "2024-10-24 06:00").Format(time.RFC3339),
+		PendingRun: &scheduledRun{
+			ScheduledTime:   estTime(t, "2024-10-24 06:00").Format(time.RFC3339),
+			GameDate:        "2024-10-22",
+			CompletedStages: []string{string(FetchRawGames)},
+			Attempts:        1,
+			NextAttemptTime: estTime(t, "2024-10-24 06:25").Format(time.RFC3339),
+		},
+	}
+	if err := saveSchedulerState(s.statePath, state); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ProcessType{CleanAllGames, CombineGameWithOdds}
+	if got := attemptedStages(stages.attempts); !slices.Equal(got, want) {
+		t.Fatalf("stages: got %v, want %v", got, want)
+	}
+	if retryTime := estTime(t, "2024-10-24 06:25"); !stages.attempts[0].time.Equal(retryTime) {
+		t.Errorf("expected the retry at %s, got %s", retryTime, stages.attempts[0].time)
+	}
+}
@@ -2,78 +2,164 @@ package helpers
 
 import (
 	"errors"
-	"flag"
 	"io"
-	"log"
 	"os"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 /* Funcs for setting up globals, parsing command arguments */
-func Setup() (processName string, date string, logFile *os.File) {
-	processNameArg := flag.String("process", "", "Specify the process to run")
-	dateArg := flag.String("date", "", "Specify the game date to run")
-	configArg := flag.String("config", "", "Specify the absolute path of the config file")
-	flag.Parse()
+func Setup(args []string) (options *RunOptions, logFile io.Closer) {
+	cmd, cmdArgs := parseCommand(args)
 
-	cfg, err := readConfigFile(*configArg)
+	cfg, err := readConfigFile(*cmdArgs.config)
 	if err != nil {
 		ErrorWithFailure(err)
 	}
-	Config = cfg
-
-	file, err := initializeLogger(logFilePath)
+	stages, err := parseStages(valueOrEmpty(cmdArgs.stages))
 	if err != nil {
 		ErrorWithFailure(err)
 	}
+	/* The sampling flags take precedence over the config, so they are validated with it */
+	if valueOrEmpty(cmdArgs.sampling) != "" {
+		cfg.Sampling.Granularities = strings.Split(*cmdArgs.sampling, ",")
+	}
+	if valueOrEmpty(cmdArgs.granularity) != "" {
+		cfg.Sampling.CsvGranularity = *cmdArgs.granularity
+	}
+	if err = validateConfig(cfg, cmd.process, stages); err != nil {
+		ErrorWithFailure(err)
+	}
+	Config = cfg
+	DryRun = *cmdArgs.dryRun
+	Lenient = *cmdArgs.lenient
+	ForceUnlock = cmdArgs.forceUnlock != nil && *cmdArgs.forceUnlock
 
-	previousDate, err := getPreviousDate(*dateArg)
+	processRunId = newRunId()
+	file, err := initializeLogger(Config.Logging, processRunId, cmd.process, ternaryOperator[io.Writer](cmd.printsToStdout(), os.Stderr, os.Stdout))
 	if err != nil {
 		ErrorWithFailure(err)
 	}
+	metricsProcess = string(cmd.process)
+	if err = serveMetrics(Config.Metrics.ListenAddress); err != nil {
+		ErrorWithFailure(err)
+	}
 
-	return *processNameArg, previousDate, file
-}
-
-func initializeLogger(filePath string) (*os.File, error) {
-	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
-	if err != nil {
-		return nil, errors.New("error initializing logger")
+	if *cmdArgs.workers < 1 {
+		ErrorWithFailure(errors.New("workers must be at least 1"))
+	}
+	Workers = *cmdArgs.workers
+
+	/* The scheduler resolves the game date of every run itself and the migration copies every date */
+	var dates []string
+	if cmd.takesDates() {
+		date := *cmdArgs.date
+		lagDaysSet := cmdArgs.lagDaysSet
+		if cmdArgs.legacy && date != "" {
+			Logger.Warn("The --process flag is deprecated, run the subcommand instead", "command", cmd.name)
+			if date, err = legacyGameDate(date, *cmdArgs.lagDays, time.Now()); err != nil {
+				ErrorWithFailure(err)
+			}
+			/* The lag is already taken off the run date */
+			lagDaysSet = false
+		}
+		dates, err = resolveRunDates(date, *cmdArgs.startDate, *cmdArgs.endDate, *cmdArgs.season, *cmdArgs.lagDays, lagDaysSet, time.Now())
+		if err != nil {
+			ErrorWithFailure(err)
+		}
+		Logger.Info("Resolved game dates", "gameDates", describeDates(dates))
+	} else if *cmdArgs.lagDays < 0 {
+		ErrorWithFailure(errors.New("lag days must not be negative"))
+	}
+	settings := newRunSettings(*Config)
+	Logger.Info("Effective pipeline settings", "bookmakers", settings.Odds.Bookmakers, "snapshotUtcHours", settings.Odds.SnapshotUtcHours,
+		"historicalOddsPath", settings.HistoricalOddsPath, "csv", settings.Csv, "collections", settings.Collections, "sampling", settings.Sampling, "logPath", settings.LogPath)
+	if DryRun {
+		Logger.Info("Dry run enabled. No database or csv writes will be applied")
 	}
 
-	multiWriter := io.MultiWriter(os.Stdout, file)
-	Logger = log.New(multiWriter, "", log.Ldate|log.Ltime|log.Lshortfile)
-	return file, nil
+	return &RunOptions{
+		ProcessName: string(cmd.process),
+		RunId:       processRunId,
+		Dates:       dates,
+		Stages:      stages,
+		ReportPath:  valueOrEmpty(cmdArgs.report),
+		Schedule:    ternaryOperator(valueOrEmpty(cmdArgs.schedule) == "", Config.Scheduler.Schedule, valueOrEmpty(cmdArgs.schedule)),
+		LagDays:     *cmdArgs.lagDays,
+	}, file
 }
 
+/* Layers the environment variables and secret files over the config file, then fills in the defaults */
 func readConfigFile(configFileName string) (*NbaConfig, error) {
-	f, err := os.Open(configFileName)
-
-	if err != nil {
-		return nil, errors.New("error reading config file")
+	var cfg NbaConfig
+	presetConfigDefaults(&cfg)
+	if configFileName != "" {
+		f, err := os.Open(configFileName)
+		if err != nil {
+			return nil, errors.New("error reading config file: " + err.Error())
+		}
+		defer f.Close()
+
+		/* Unknown keys are usually typos, which would otherwise silently fall back to the defaults */
+		decoder := yaml.NewDecoder(f)
+		decoder.KnownFields(true)
+		if err = decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, errors.New("error reading config file " + configFileName + ": " + err.Error())
+		}
 	}
-	defer f.Close()
-
-	decoder := yaml.NewDecoder(f)
 
-	var cfg NbaConfig
-	err = decoder.Decode(&cfg)
-	if err != nil {
-		return nil, errors.New("error reading config file")
+	if err := applyEnvOverrides(&cfg); err != nil {
+		return nil, err
+	}
+	if err := readSecretFiles(&cfg); err != nil {
+		return nil, err
 	}
+	applyConfigDefaults(&cfg)
 	return &cfg, nil
 }
 
-func getPreviousDate(date string) (previousDay string, err error) {
-	layout := "2006-01-02"
-
-	dateAsTime, err := time.Parse(layout, date)
-	if err != nil {
-		return "", errors.New("error processing date parameter")
-	}
+/*
+Fields where 0 is a setting of its own, ex. logging.maxBackups of 0 keeping no backups or scheduler.retries of 0
+never retrying, get their defaults before the config file and the environment are read, so an explicit 0 is kept
+*/
+func presetConfigDefaults(cfg *NbaConfig) {
+	cfg.Logging.MaxBackups = defaultLogMaxBackups
+	cfg.Scheduler.Retries = defaultSchedulerRetries
+	cfg.Scheduler.RetryDelay = defaultSchedulerRetryDelay
+}
 
-	newDate := dateAsTime.AddDate(0, 0, -2)
-	return newDate.Format(layout), nil
+func applyConfigDefaults(cfg *NbaConfig) {
+	cfg.Database.Backend = ternaryOperator(cfg.Database.Backend == "", defaultDatabaseBackend, cfg.Database.Backend)
+	cfg.Database.ConnectTimeout = ternaryOperator(cfg.Database.ConnectTimeout == 0, defaultMongoConnectTimeout, cfg.Database.ConnectTimeout)
+	cfg.Database.ServerSelectionTimeout = ternaryOperator(cfg.Database.ServerSelectionTimeout == 0, defaultMongoServerSelectionTimeout, cfg.Database.ServerSelectionTimeout)
+	cfg.Database.SqlitePath = ternaryOperator(cfg.Database.SqlitePath == "", defaultSqlitePath, cfg.Database.SqlitePath)
+	cfg.Logging.Path = ternaryOperator(cfg.Logging.Path == "", defaultLogFilePath, cfg.Logging.Path)
+	cfg.Logging.Level = ternaryOperator(cfg.Logging.Level == "", defaultLogLevel, cfg.Logging.Level)
+	cfg.Logging.Format = ternaryOperator(cfg.Logging.Format == "", defaultLogFormat, cfg.Logging.Format)
+	cfg.Logging.MaxSizeMb = ternaryOperator(cfg.Logging.MaxSizeMb == 0, defaultLogMaxSizeMb, cfg.Logging.MaxSizeMb)
+	cfg.OddsApi.BaseUrl = ternaryOperator(cfg.OddsApi.BaseUrl == "", defaultOddsApiBaseUrl, cfg.OddsApi.BaseUrl)
+	cfg.OddsApi.HistoricalOddsPath = ternaryOperator(cfg.OddsApi.HistoricalOddsPath == "", defaultOddsApiHistoricalOddsPath, cfg.OddsApi.HistoricalOddsPath)
+	cfg.Report.Directory = ternaryOperator(cfg.Report.Directory == "", defaultReportDirectory, cfg.Report.Directory)
+	cfg.StatsApi.BaseUrl = ternaryOperator(cfg.StatsApi.BaseUrl == "", defaultStatsApiBaseUrl, cfg.StatsApi.BaseUrl)
+	cfg.StatsApi.RequestInterval = ternaryOperator(cfg.StatsApi.RequestInterval == 0, defaultStatsApiRequestInterval, cfg.StatsApi.RequestInterval)
+	cfg.StatsApi.Timeout = ternaryOperator(cfg.StatsApi.Timeout == 0, defaultStatsApiTimeout, cfg.StatsApi.Timeout)
+	cfg.Scheduler.Schedule = ternaryOperator(cfg.Scheduler.Schedule == "", defaultSchedule, cfg.Scheduler.Schedule)
+	cfg.Scheduler.StateFile = ternaryOperator(cfg.Scheduler.StateFile == "", defaultSchedulerStateFile, cfg.Scheduler.StateFile)
+	cfg.Odds.Bookmakers = ternaryOperator(len(cfg.Odds.Bookmakers) == 0, defaultBookmakers, cfg.Odds.Bookmakers)
+	cfg.Odds.SnapshotUtcHours = ternaryOperator(len(cfg.Odds.SnapshotUtcHours) == 0, defaultSnapshotUtcHours, cfg.Odds.SnapshotUtcHours)
+	cfg.Csv.Directory = ternaryOperator(cfg.Csv.Directory == "", defaultCsvDirectory, cfg.Csv.Directory)
+	cfg.Csv.GamesFileName = ternaryOperator(cfg.Csv.GamesFileName == "", defaultGamesCsvFileName, cfg.Csv.GamesFileName)
+	cfg.Csv.PlaysFileName = ternaryOperator(cfg.Csv.PlaysFileName == "", defaultPlaysCsvFileName, cfg.Csv.PlaysFileName)
+	cfg.Csv.ParquetDirectory = ternaryOperator(cfg.Csv.ParquetDirectory == "", defaultParquetDirectory, cfg.Csv.ParquetDirectory)
+	cfg.Collections.CleanedGames = ternaryOperator(cfg.Collections.CleanedGames == "", defaultCollections.CleanedGames, cfg.Collections.CleanedGames)
+	cfg.Collections.CleanedOdds = ternaryOperator(cfg.Collections.CleanedOdds == "", defaultCollections.CleanedOdds, cfg.Collections.CleanedOdds)
+	cfg.Collections.RawOdds = ternaryOperator(cfg.Collections.RawOdds == "", defaultCollections.RawOdds, cfg.Collections.RawOdds)
+	cfg.Collections.PipelineLocks = ternaryOperator(cfg.Collections.PipelineLocks == "", defaultCollections.PipelineLocks, cfg.Collections.PipelineLocks)
+	cfg.Collections.PipelineRuns = ternaryOperator(cfg.Collections.PipelineRuns == "", defaultCollections.PipelineRuns, cfg.Collections.PipelineRuns)
+	cfg.Collections.ProcessingErrors = ternaryOperator(cfg.Collections.ProcessingErrors == "", defaultCollections.ProcessingErrors, cfg.Collections.ProcessingErrors)
+	cfg.Collections.RawGames = ternaryOperator(cfg.Collections.RawGames == "", defaultCollections.RawGames, cfg.Collections.RawGames)
+	cfg.Collections.TeamMetadata = ternaryOperator(cfg.Collections.TeamMetadata == "", defaultCollections.TeamMetadata, cfg.Collections.TeamMetadata)
+	cfg.Sampling.CsvGranularity = ternaryOperator(cfg.Sampling.CsvGranularity == "", defaultGranularity, cfg.Sampling.CsvGranularity)
 }
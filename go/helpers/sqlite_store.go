@@ -0,0 +1,963 @@
+package helpers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+/*
+Store backed by a SQLite file, for running the pipeline locally without MongoDB. Every collection
+is normalized into tables, only the raw play by play rows are kept as the stats API's json arrays
+since their columns are whatever the API returns
+*/
+type sqliteStore struct {
+	db *sql.DB
+}
+
+/* Satisfied by both *sql.DB and *sql.Tx */
+type sqlQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS team_metadata (
+	team_id           INTEGER PRIMARY KEY,
+	team_name         TEXT NOT NULL,
+	team_abbreviation TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS raw_games (
+	game_id      TEXT PRIMARY KEY,
+	date         TEXT NOT NULL,
+	matchup      TEXT NOT NULL,
+	season_id    TEXT NOT NULL,
+	resource     TEXT NOT NULL,
+	start_period INTEGER NOT NULL,
+	end_period   INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS raw_games_date ON raw_games (date);
+
+CREATE TABLE IF NOT EXISTS raw_game_plays (
+	game_id    TEXT NOT NULL REFERENCES raw_games (game_id) ON DELETE CASCADE,
+	play_index INTEGER NOT NULL,
+	fields     TEXT NOT NULL,
+	PRIMARY KEY (game_id, play_index)
+);
+
+CREATE TABLE IF NOT EXISTS raw_odds (
+	date               TEXT NOT NULL,
+	utc_hour           INTEGER NOT NULL,
+	timestamp          TEXT NOT NULL,
+	previous_timestamp TEXT NOT NULL,
+	next_timestamp     TEXT NOT NULL,
+	PRIMARY KEY (date, utc_hour)
+);
+
+CREATE TABLE IF NOT EXISTS raw_odds_games (
+	date          TEXT NOT NULL,
+	utc_hour      INTEGER NOT NULL,
+	game_index    INTEGER NOT NULL,
+	odds_game_id  TEXT NOT NULL,
+	sport_key     TEXT NOT NULL,
+	sport_title   TEXT NOT NULL,
+	commence_time TEXT NOT NULL,
+	home_team     TEXT NOT NULL,
+	away_team     TEXT NOT NULL,
+	PRIMARY KEY (date, utc_hour, game_index),
+	FOREIGN KEY (date, utc_hour) REFERENCES raw_odds (date, utc_hour) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS raw_odds_bookmakers (
+	date            TEXT NOT NULL,
+	utc_hour        INTEGER NOT NULL,
+	game_index      INTEGER NOT NULL,
+	bookmaker_index INTEGER NOT NULL,
+	key             TEXT NOT NULL,
+	title           TEXT NOT NULL,
+	last_update     TEXT NOT NULL,
+	PRIMARY KEY (date, utc_hour, game_index, bookmaker_index),
+	FOREIGN KEY (date, utc_hour) REFERENCES raw_odds (date, utc_hour) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS raw_odds_markets (
+	date            TEXT NOT NULL,
+	utc_hour        INTEGER NOT NULL,
+	game_index      INTEGER NOT NULL,
+	bookmaker_index INTEGER NOT NULL,
+	market_index    INTEGER NOT NULL,
+	key             TEXT NOT NULL,
+	last_update     TEXT NOT NULL,
+	PRIMARY KEY (date, utc_hour, game_index, bookmaker_index, market_index),
+	FOREIGN KEY (date, utc_hour) REFERENCES raw_odds (date, utc_hour) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS raw_odds_outcomes (
+	date            TEXT NOT NULL,
+	utc_hour        INTEGER NOT NULL,
+	game_index      INTEGER NOT NULL,
+	bookmaker_index INTEGER NOT NULL,
+	market_index    INTEGER NOT NULL,
+	outcome_index   INTEGER NOT NULL,
+	name            TEXT NOT NULL,
+	price           REAL NOT NULL,
+	point           REAL NOT NULL,
+	PRIMARY KEY (date, utc_hour, game_index, bookmaker_index, market_index, outcome_index),
+	FOREIGN KEY (date, utc_hour) REFERENCES raw_odds (date, utc_hour) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS cleaned_games (
+	game_id      TEXT PRIMARY KEY,
+	date         TEXT NOT NULL,
+	start_time   TEXT NOT NULL,
+	away_team_id TEXT NOT NULL,
+	home_team_id     TEXT NOT NULL,
+	season_id        TEXT NOT NULL,
+	overtime         INTEGER NOT NULL DEFAULT 0,
+	overtime_periods INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS cleaned_games_date ON cleaned_games (date);
+
+CREATE TABLE IF NOT EXISTS cleaned_game_intervals (
+	game_id         TEXT NOT NULL REFERENCES cleaned_games (game_id) ON DELETE CASCADE,
+	interval_index    INTEGER NOT NULL,
+	seconds_elapsed   INTEGER NOT NULL,
+	period            INTEGER NOT NULL DEFAULT 0,
+	seconds_remaining INTEGER NOT NULL DEFAULT 0,
+	away_score        INTEGER NOT NULL,
+	home_score        INTEGER NOT NULL,
+	PRIMARY KEY (game_id, interval_index)
+);
+
+CREATE TABLE IF NOT EXISTS cleaned_game_samplings (
+	game_id         TEXT NOT NULL REFERENCES cleaned_games (game_id) ON DELETE CASCADE,
+	sampling_index  INTEGER NOT NULL,
+	granularity     TEXT NOT NULL,
+	interval_index    INTEGER NOT NULL,
+	seconds_elapsed   INTEGER NOT NULL,
+	period            INTEGER NOT NULL,
+	seconds_remaining INTEGER NOT NULL,
+	away_score        INTEGER NOT NULL,
+	home_score        INTEGER NOT NULL,
+	PRIMARY KEY (game_id, sampling_index, interval_index)
+);
+
+CREATE TABLE IF NOT EXISTS cleaned_odds (
+	game_id              TEXT PRIMARY KEY,
+	bookmaker            TEXT NOT NULL,
+	moneyline_away_price REAL NOT NULL,
+	moneyline_home_price REAL NOT NULL,
+	spread_away_spread   REAL NOT NULL,
+	spread_home_spread   REAL NOT NULL,
+	spread_away_price    REAL NOT NULL,
+	spread_home_price    REAL NOT NULL,
+	total                REAL NOT NULL,
+	total_over_price     REAL NOT NULL,
+	total_under_price    REAL NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS processing_errors (
+	game_id     TEXT NOT NULL,
+	process     TEXT NOT NULL,
+	date        TEXT NOT NULL,
+	reason      TEXT NOT NULL,
+	recorded_at TEXT NOT NULL,
+	PRIMARY KEY (game_id, process)
+);
+
+CREATE TABLE IF NOT EXISTS pipeline_runs (
+	run_id                 TEXT NOT NULL,
+	game_date              TEXT NOT NULL,
+	stage                  TEXT NOT NULL,
+	status                 TEXT NOT NULL,
+	start_time             TEXT NOT NULL,
+	end_time               TEXT NOT NULL,
+	games_found            INTEGER NOT NULL,
+	games_cleaned          INTEGER NOT NULL,
+	games_failed           INTEGER NOT NULL,
+	odds_snapshots_fetched INTEGER NOT NULL,
+	odds_matched           INTEGER NOT NULL,
+	code_version           TEXT NOT NULL,
+	error                  TEXT NOT NULL,
+	PRIMARY KEY (run_id, game_date, stage)
+);
+CREATE INDEX IF NOT EXISTS pipeline_runs_game_date ON pipeline_runs (game_date);
+
+CREATE TABLE IF NOT EXISTS pipeline_run_collection_writes (
+	run_id     TEXT NOT NULL,
+	game_date  TEXT NOT NULL,
+	stage      TEXT NOT NULL,
+	collection TEXT NOT NULL,
+	matched    INTEGER NOT NULL,
+	modified   INTEGER NOT NULL,
+	upserted   INTEGER NOT NULL,
+	PRIMARY KEY (run_id, game_date, stage, collection),
+	FOREIGN KEY (run_id, game_date, stage) REFERENCES pipeline_runs (run_id, game_date, stage) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS pipeline_run_csv_writes (
+	run_id    TEXT NOT NULL,
+	game_date TEXT NOT NULL,
+	stage     TEXT NOT NULL,
+	csv       TEXT NOT NULL,
+	inserted  INTEGER NOT NULL,
+	updated   INTEGER NOT NULL,
+	deleted   INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (run_id, game_date, stage, csv),
+	FOREIGN KEY (run_id, game_date, stage) REFERENCES pipeline_runs (run_id, game_date, stage) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS pipeline_locks (
+	lock_id     TEXT PRIMARY KEY,
+	stage       TEXT NOT NULL,
+	game_date   TEXT NOT NULL,
+	run_id      TEXT NOT NULL,
+	host        TEXT NOT NULL,
+	pid         INTEGER NOT NULL,
+	acquired_at INTEGER NOT NULL,
+	expires_at  INTEGER NOT NULL
+);
+`
+
+/*
+Creates the file and its tables when missing. Foreign keys are enforced, so deleting a document deletes its child rows.
+Dry runs create nothing: an existing file is opened read only, and a missing one is read as an empty database in memory
+*/
+func newSqliteStore(path string) (*sqliteStore, error) {
+	if DryRun {
+		return openDryRunSqliteStore(path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", "file:"+path+"?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, errors.New("error opening sqlite database " + path + ": " + err.Error())
+	}
+	/* SQLite allows a single writer, so one connection avoids lock errors between workers */
+	db.SetMaxOpenConns(1)
+	if _, err = db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, errors.New("error creating sqlite tables in " + path + ": " + err.Error())
+	}
+	if err = addSqliteColumns(db); err != nil {
+		db.Close()
+		return nil, errors.New("error adding sqlite columns in " + path + ": " + err.Error())
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+/* A file from before a column was added can't be read in a dry run, since adding the column writes to it */
+func openDryRunSqliteStore(path string) (*sqliteStore, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		Logger.Info("Dry run: reading a missing sqlite database as empty", "sqlitePath", path)
+		db, err := sql.Open("sqlite3", "file::memory:?_foreign_keys=on")
+		if err != nil {
+			return nil, errors.New("error opening in memory sqlite database: " + err.Error())
+		}
+		/* Every connection to :memory: opens its own database */
+		db.SetMaxOpenConns(1)
+		if _, err = db.Exec(sqliteSchema); err != nil {
+			db.Close()
+			return nil, errors.New("error creating in memory sqlite tables: " + err.Error())
+		}
+		return &sqliteStore{db: db}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro&_foreign_keys=on&_busy_timeout=5000")
+	if err != nil {
+		return nil, errors.New("error opening sqlite database " + path + ": " + err.Error())
+	}
+	db.SetMaxOpenConns(1)
+	missingColumns, err := missingSqliteColumns(db)
+	if err == nil && len(missingColumns) > 0 {
+		err = fmt.Errorf("missing column %s.%s, run once without --dry-run to add it", missingColumns[0][0], missingColumns[0][1])
+	}
+	if err != nil {
+		db.Close()
+		return nil, errors.New("error reading sqlite database " + path + ": " + err.Error())
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+/* Columns added after their table, which CREATE TABLE IF NOT EXISTS leaves out of older databases. Older rows read 0, see cleanedBeforePeriods */
+var sqliteAddedColumns = [][3]string{
+	{"cleaned_games", "overtime", "INTEGER NOT NULL DEFAULT 0"},
+	{"cleaned_games", "overtime_periods", "INTEGER NOT NULL DEFAULT 0"},
+	{"cleaned_game_intervals", "period", "INTEGER NOT NULL DEFAULT 0"},
+	{"cleaned_game_intervals", "seconds_remaining", "INTEGER NOT NULL DEFAULT 0"},
+	{"pipeline_run_csv_writes", "deleted", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+func addSqliteColumns(db *sql.DB) error {
+	missingColumns, err := missingSqliteColumns(db)
+	if err != nil {
+		return err
+	}
+	for _, column := range missingColumns {
+		if _, err = db.Exec(`ALTER TABLE ` + column[0] + ` ADD COLUMN ` + column[1] + ` ` + column[2]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func missingSqliteColumns(db *sql.DB) ([][3]string, error) {
+	var missingColumns [][3]string
+	for _, column := range sqliteAddedColumns {
+		var count int
+		err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, column[0], column[1]).Scan(&count)
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			missingColumns = append(missingColumns, column)
+		}
+	}
+	return missingColumns, nil
+}
+
+func (store *sqliteStore) Close(ctx context.Context) error {
+	return store.db.Close()
+}
+
+func (store *sqliteStore) FindTeamMetadata(ctx context.Context) (teamMetadata []TeamMetadata, err error) {
+	rows, err := store.db.QueryContext(ctx, `SELECT team_id, team_name, team_abbreviation FROM team_metadata ORDER BY team_id`)
+	if err != nil {
+		return nil, errors.New("error doing db lookup for team metadata")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var team TeamMetadata
+		if err = rows.Scan(&team.TeamId, &team.TeamName, &team.TeamAbbreviaton); err != nil {
+			return nil, err
+		}
+		teamMetadata = append(teamMetadata, team)
+	}
+	return teamMetadata, rows.Err()
+}
+
+/* Only used by the migration, the pipeline never writes team metadata */
+func (store *sqliteStore) upsertTeamMetadata(ctx context.Context, teams []TeamMetadata) error {
+	return upsertSqliteDocuments(ctx, store, Config.Collections.TeamMetadata, teams,
+		func(team TeamMetadata) bson.M { return bson.M{"teamId": team.TeamId} },
+		func(ctx context.Context, q sqlQuerier, team TeamMetadata) (*TeamMetadata, error) {
+			var existing TeamMetadata
+			err := q.QueryRowContext(ctx, `SELECT team_id, team_name, team_abbreviation FROM team_metadata WHERE team_id = ?`, team.TeamId).
+				Scan(&existing.TeamId, &existing.TeamName, &existing.TeamAbbreviaton)
+			return scannedDocument(&existing, err)
+		},
+		func(ctx context.Context, q sqlQuerier, team TeamMetadata) error {
+			_, err := q.ExecContext(ctx, `INSERT OR REPLACE INTO team_metadata (team_id, team_name, team_abbreviation) VALUES (?, ?, ?)`,
+				team.TeamId, team.TeamName, team.TeamAbbreviaton)
+			return err
+		})
+}
+
+func (store *sqliteStore) FindRawGames(ctx context.Context, date string) ([]RawNbaGame, error) {
+	rawGames, err := findSqliteRawGames(ctx, store.db, `WHERE date = ?`, date)
+	if err != nil {
+		return nil, errors.New("error fetching from raw games DB")
+	}
+	return rawGames, nil
+}
+
+func (store *sqliteStore) FindExistingRawGameIds(ctx context.Context, gameIds []string) (existingIds []string, err error) {
+	rows, err := store.db.QueryContext(ctx, `SELECT game_id FROM raw_games WHERE game_id IN (`+sqlPlaceholders(len(gameIds))+`)`, sqlArgs(gameIds)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var gameId string
+		if err = rows.Scan(&gameId); err != nil {
+			return nil, err
+		}
+		existingIds = append(existingIds, gameId)
+	}
+	return existingIds, rows.Err()
+}
+
+func (store *sqliteStore) CountRawGames(ctx context.Context, date string) (count int64, err error) {
+	err = store.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM raw_games WHERE date = ?`, date).Scan(&count)
+	return count, err
+}
+
+func (store *sqliteStore) UpsertRawGames(ctx context.Context, games []RawNbaGame) error {
+	return upsertSqliteDocuments(ctx, store, Config.Collections.RawGames, games,
+		func(game RawNbaGame) bson.M { return gameIdFilter(game.GameId) },
+		func(ctx context.Context, q sqlQuerier, game RawNbaGame) (*RawNbaGame, error) {
+			existing, err := findSqliteRawGames(ctx, q, `WHERE game_id = ?`, game.GameId)
+			if err != nil || len(existing) == 0 {
+				return nil, err
+			}
+			return &existing[0], nil
+		},
+		writeSqliteRawGame)
+}
+
+func writeSqliteRawGame(ctx context.Context, q sqlQuerier, game RawNbaGame) error {
+	if _, err := q.ExecContext(ctx, `DELETE FROM raw_games WHERE game_id = ?`, game.GameId); err != nil {
+		return err
+	}
+	_, err := q.ExecContext(ctx, `INSERT INTO raw_games (game_id, date, matchup, season_id, resource, start_period, end_period) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		game.GameId, game.Date, game.Matchup, game.SeasonId, game.Resource, game.Parameters.StarPeriod, game.Parameters.EndPeriod)
+	if err != nil {
+		return err
+	}
+	for i, play := range game.PlayByPlayRows {
+		fields, err := json.Marshal(play)
+		if err != nil {
+			return err
+		}
+		if _, err = q.ExecContext(ctx, `INSERT INTO raw_game_plays (game_id, play_index, fields) VALUES (?, ?, ?)`, game.GameId, i, string(fields)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/* Play by play fields are decoded into the same bson types the stats API client stores */
+func findSqliteRawGames(ctx context.Context, q sqlQuerier, where string, args ...any) (rawGames []RawNbaGame, err error) {
+	rows, err := q.QueryContext(ctx, `SELECT game_id, date, matchup, season_id, resource, start_period, end_period FROM raw_games `+where+` ORDER BY game_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var game RawNbaGame
+		err = rows.Scan(&game.GameId, &game.Date, &game.Matchup, &game.SeasonId, &game.Resource, &game.Parameters.StarPeriod, &game.Parameters.EndPeriod)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		game.Parameters.GameId = game.GameId
+		rawGames = append(rawGames, game)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range rawGames {
+		if rawGames[i].PlayByPlayRows, err = findSqliteRawGamePlays(ctx, q, rawGames[i].GameId); err != nil {
+			return nil, err
+		}
+	}
+	return rawGames, nil
+}
+
+func findSqliteRawGamePlays(ctx context.Context, q sqlQuerier, gameId string) (bson.A, error) {
+	rows, err := q.QueryContext(ctx, `SELECT fields FROM raw_game_plays WHERE game_id = ? ORDER BY play_index`, gameId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var plays [][]interface{}
+	for rows.Next() {
+		var fields string
+		if err = rows.Scan(&fields); err != nil {
+			return nil, err
+		}
+		var play []interface{}
+		decoder := json.NewDecoder(strings.NewReader(fields))
+		decoder.UseNumber()
+		if err = decoder.Decode(&play); err != nil {
+			return nil, errors.New("error decoding play by play row of game " + gameId)
+		}
+		plays = append(plays, play)
+	}
+	return rowsToBson(plays), rows.Err()
+}
+
+func (store *sqliteStore) FindRawOdds(ctx context.Context, date string, utcHour int) (*RawOddsResponse, error) {
+	return findSqliteRawOdds(ctx, store.db, date, utcHour)
+}
+
+func (store *sqliteStore) CountRawOdds(ctx context.Context, date string, utcHours []int) (count int64, err error) {
+	err = store.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM raw_odds WHERE date = ? AND utc_hour IN (`+sqlPlaceholders(len(utcHours))+`)`,
+		append([]any{date}, sqlArgs(utcHours)...)...).Scan(&count)
+	return count, err
+}
+
+func (store *sqliteStore) UpsertRawOdds(ctx context.Context, odds []RawOddsResponse) error {
+	return upsertSqliteDocuments(ctx, store, Config.Collections.RawOdds, odds,
+		func(odds RawOddsResponse) bson.M { return rawOddsDbFilter(odds.Date, odds.UtcHour) },
+		func(ctx context.Context, q sqlQuerier, odds RawOddsResponse) (*RawOddsResponse, error) {
+			return findSqliteRawOdds(ctx, q, odds.Date, odds.UtcHour)
+		},
+		writeSqliteRawOdds)
+}
+
+func writeSqliteRawOdds(ctx context.Context, q sqlQuerier, odds RawOddsResponse) error {
+	if _, err := q.ExecContext(ctx, `DELETE FROM raw_odds WHERE date = ? AND utc_hour = ?`, odds.Date, odds.UtcHour); err != nil {
+		return err
+	}
+	_, err := q.ExecContext(ctx, `INSERT INTO raw_odds (date, utc_hour, timestamp, previous_timestamp, next_timestamp) VALUES (?, ?, ?, ?, ?)`,
+		odds.Date, odds.UtcHour, odds.Timestamp, odds.PreviousTimestamp, odds.NextTimestamp)
+	if err != nil {
+		return err
+	}
+
+	key := []any{odds.Date, odds.UtcHour}
+	for g, game := range odds.Data {
+		_, err = q.ExecContext(ctx, `INSERT INTO raw_odds_games (date, utc_hour, game_index, odds_game_id, sport_key, sport_title, commence_time, home_team, away_team) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			append(key, g, game.Id, game.SportKey, game.SportTitle, game.CommenceTime, game.HomeTeam, game.AwayTeam)...)
+		if err != nil {
+			return err
+		}
+		for b, bookmaker := range game.Bookmakers {
+			_, err = q.ExecContext(ctx, `INSERT INTO raw_odds_bookmakers (date, utc_hour, game_index, bookmaker_index, key, title, last_update) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+				append(key, g, b, bookmaker.Key, bookmaker.Title, bookmaker.LastUpdate)...)
+			if err != nil {
+				return err
+			}
+			for m, market := range bookmaker.Markets {
+				_, err = q.ExecContext(ctx, `INSERT INTO raw_odds_markets (date, utc_hour, game_index, bookmaker_index, market_index, key, last_update) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+					append(key, g, b, m, market.Key, market.LastUpdate)...)
+				if err != nil {
+					return err
+				}
+				for o, outcome := range market.Outcome {
+					_, err = q.ExecContext(ctx, `INSERT INTO raw_odds_outcomes (date, utc_hour, game_index, bookmaker_index, market_index, outcome_index, name, price, point) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+						append(key, g, b, m, o, outcome.Name, outcome.Price, outcome.Point)...)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+/* Child rows are read in index order, so each one is appended to the last parent read */
+func findSqliteRawOdds(ctx context.Context, q sqlQuerier, date string, utcHour int) (*RawOddsResponse, error) {
+	odds := RawOddsResponse{Date: date, UtcHour: utcHour}
+	err := q.QueryRowContext(ctx, `SELECT timestamp, previous_timestamp, next_timestamp FROM raw_odds WHERE date = ? AND utc_hour = ?`, date, utcHour).
+		Scan(&odds.Timestamp, &odds.PreviousTimestamp, &odds.NextTimestamp)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err1 := scanSqliteRows(ctx, q, `SELECT odds_game_id, sport_key, sport_title, commence_time, home_team, away_team FROM raw_odds_games WHERE date = ? AND utc_hour = ? ORDER BY game_index`,
+		[]any{date, utcHour}, func(rows *sql.Rows) error {
+			var game OddsData
+			err := rows.Scan(&game.Id, &game.SportKey, &game.SportTitle, &game.CommenceTime, &game.HomeTeam, &game.AwayTeam)
+			odds.Data = append(odds.Data, game)
+			return err
+		})
+	err2 := scanSqliteRows(ctx, q, `SELECT game_index, key, title, last_update FROM raw_odds_bookmakers WHERE date = ? AND utc_hour = ? ORDER BY game_index, bookmaker_index`,
+		[]any{date, utcHour}, func(rows *sql.Rows) error {
+			var g int
+			var bookmaker Bookmaker
+			if err := rows.Scan(&g, &bookmaker.Key, &bookmaker.Title, &bookmaker.LastUpdate); err != nil {
+				return err
+			}
+			odds.Data[g].Bookmakers = append(odds.Data[g].Bookmakers, bookmaker)
+			return nil
+		})
+	err3 := scanSqliteRows(ctx, q, `SELECT game_index, bookmaker_index, key, last_update FROM raw_odds_markets WHERE date = ? AND utc_hour = ? ORDER BY game_index, bookmaker_index, market_index`,
+		[]any{date, utcHour}, func(rows *sql.Rows) error {
+			var g, b int
+			var market Market
+			if err := rows.Scan(&g, &b, &market.Key, &market.LastUpdate); err != nil {
+				return err
+			}
+			bookmaker := &odds.Data[g].Bookmakers[b]
+			bookmaker.Markets = append(bookmaker.Markets, market)
+			return nil
+		})
+	err4 := scanSqliteRows(ctx, q, `SELECT game_index, bookmaker_index, market_index, name, price, point FROM raw_odds_outcomes WHERE date = ? AND utc_hour = ? ORDER BY game_index, bookmaker_index, market_index, outcome_index`,
+		[]any{date, utcHour}, func(rows *sql.Rows) error {
+			var g, b, m int
+			var outcome Outcome
+			if err := rows.Scan(&g, &b, &m, &outcome.Name, &outcome.Price, &outcome.Point); err != nil {
+				return err
+			}
+			market := &odds.Data[g].Bookmakers[b].Markets[m]
+			market.Outcome = append(market.Outcome, outcome)
+			return nil
+		})
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return nil, handleMultipleErrors(err1, err2, err3, err4)
+	}
+	return &odds, nil
+}
+
+func (store *sqliteStore) FindCleanedGames(ctx context.Context, date string) ([]CleanedGame, error) {
+	return findSqliteCleanedGames(ctx, store.db, `WHERE date = ?`, date)
+}
+
+func (store *sqliteStore) CountCleanedGames(ctx context.Context, date string) (count int64, err error) {
+	err = store.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM cleaned_games WHERE date = ?`, date).Scan(&count)
+	return count, err
+}
+
+func (store *sqliteStore) UpsertCleanedGames(ctx context.Context, games []CleanedGame) error {
+	return upsertSqliteDocuments(ctx, store, Config.Collections.CleanedGames, games,
+		func(game CleanedGame) bson.M { return gameIdFilter(game.GameId) },
+		func(ctx context.Context, q sqlQuerier, game CleanedGame) (*CleanedGame, error) {
+			existing, err := findSqliteCleanedGames(ctx, q, `WHERE game_id = ?`, game.GameId)
+			if err != nil || len(existing) == 0 {
+				return nil, err
+			}
+			return &existing[0], nil
+		},
+		writeSqliteCleanedGame)
+}
+
+func writeSqliteCleanedGame(ctx context.Context, q sqlQuerier, game CleanedGame) error {
+	if _, err := q.ExecContext(ctx, `DELETE FROM cleaned_games WHERE game_id = ?`, game.GameId); err != nil {
+		return err
+	}
+	_, err := q.ExecContext(ctx, `INSERT INTO cleaned_games (game_id, date, start_time, away_team_id, home_team_id, season_id, overtime, overtime_periods) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		game.GameId, game.Date, game.StartTime, game.AwayTeamId, game.HomeTeamId, game.SeasonId, game.Overtime, game.OvertimePeriods)
+	if err != nil {
+		return err
+	}
+	for i, interval := range game.PlayByPlay {
+		_, err = q.ExecContext(ctx, `INSERT INTO cleaned_game_intervals (game_id, interval_index, seconds_elapsed, period, seconds_remaining, away_score, home_score) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			game.GameId, i, interval.SecondsElapsed, interval.Period, interval.SecondsRemaining, interval.AwayScore, interval.HomeScore)
+		if err != nil {
+			return err
+		}
+	}
+	for i, sampling := range game.Samplings {
+		for j, interval := range sampling.PlayByPlay {
+			_, err = q.ExecContext(ctx, `INSERT INTO cleaned_game_samplings (game_id, sampling_index, granularity, interval_index, seconds_elapsed, period, seconds_remaining, away_score, home_score) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				game.GameId, i, sampling.Granularity, j, interval.SecondsElapsed, interval.Period, interval.SecondsRemaining, interval.AwayScore, interval.HomeScore)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func findSqliteCleanedGames(ctx context.Context, q sqlQuerier, where string, args ...any) (games []CleanedGame, err error) {
+	err = scanSqliteRows(ctx, q, `SELECT game_id, date, start_time, away_team_id, home_team_id, season_id, overtime, overtime_periods FROM cleaned_games `+where+` ORDER BY game_id`,
+		args, func(rows *sql.Rows) error {
+			var game CleanedGame
+			err := rows.Scan(&game.GameId, &game.Date, &game.StartTime, &game.AwayTeamId, &game.HomeTeamId, &game.SeasonId, &game.Overtime, &game.OvertimePeriods)
+			games = append(games, game)
+			return err
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range games {
+		err = scanSqliteRows(ctx, q, `SELECT seconds_elapsed, period, seconds_remaining, away_score, home_score FROM cleaned_game_intervals WHERE game_id = ? ORDER BY interval_index`,
+			[]any{games[i].GameId}, func(rows *sql.Rows) error {
+				var interval PlayByPlay
+				err := rows.Scan(&interval.SecondsElapsed, &interval.Period, &interval.SecondsRemaining, &interval.AwayScore, &interval.HomeScore)
+				games[i].PlayByPlay = append(games[i].PlayByPlay, interval)
+				return err
+			})
+		if err != nil {
+			return nil, err
+		}
+		if games[i].Samplings, err = findSqliteCleanedGameSamplings(ctx, q, games[i].GameId); err != nil {
+			return nil, err
+		}
+	}
+	return games, nil
+}
+
+/* Rows are ordered by sampling, so a new sampling starts whenever the sampling index changes */
+func findSqliteCleanedGameSamplings(ctx context.Context, q sqlQuerier, gameId string) (samplings []Sampling, err error) {
+	prevIndex := -1
+	err = scanSqliteRows(ctx, q, `SELECT sampling_index, granularity, seconds_elapsed, period, seconds_remaining, away_score, home_score FROM cleaned_game_samplings WHERE game_id = ? ORDER BY sampling_index, interval_index`,
+		[]any{gameId}, func(rows *sql.Rows) error {
+			var samplingIndex int
+			var granularity string
+			var interval PlayByPlay
+			if err := rows.Scan(&samplingIndex, &granularity, &interval.SecondsElapsed, &interval.Period, &interval.SecondsRemaining, &interval.AwayScore, &interval.HomeScore); err != nil {
+				return err
+			}
+			if samplingIndex != prevIndex {
+				samplings = append(samplings, Sampling{Granularity: granularity})
+				prevIndex = samplingIndex
+			}
+			samplings[len(samplings)-1].PlayByPlay = append(samplings[len(samplings)-1].PlayByPlay, interval)
+			return nil
+		})
+	return samplings, err
+}
+
+func (store *sqliteStore) FindCleanedOdds(ctx context.Context, gameIds []string) ([]CleanedOdds, error) {
+	return findSqliteCleanedOdds(ctx, store.db, `WHERE game_id IN (`+sqlPlaceholders(len(gameIds))+`)`, sqlArgs(gameIds)...)
+}
+
+func (store *sqliteStore) UpsertCleanedOdds(ctx context.Context, odds []CleanedOdds) error {
+	return upsertSqliteDocuments(ctx, store, Config.Collections.CleanedOdds, odds,
+		func(odds CleanedOdds) bson.M { return gameIdFilter(odds.GameId) },
+		func(ctx context.Context, q sqlQuerier, odds CleanedOdds) (*CleanedOdds, error) {
+			existing, err := findSqliteCleanedOdds(ctx, q, `WHERE game_id = ?`, odds.GameId)
+			if err != nil || len(existing) == 0 {
+				return nil, err
+			}
+			return &existing[0], nil
+		},
+		func(ctx context.Context, q sqlQuerier, odds CleanedOdds) error {
+			_, err := q.ExecContext(ctx, `INSERT OR REPLACE INTO cleaned_odds (game_id, bookmaker, moneyline_away_price, moneyline_home_price, spread_away_spread, spread_home_spread, spread_away_price, spread_home_price, total, total_over_price, total_under_price) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				odds.GameId, odds.Bookmaker, odds.MoneyLine.AwayPrice, odds.MoneyLine.HomePrice,
+				odds.PointSpread.AwaySpread, odds.PointSpread.HomeSpread, odds.PointSpread.AwayPrice, odds.PointSpread.HomePrice,
+				odds.Total.Total, odds.Total.OverPrice, odds.Total.UnderPrice)
+			return err
+		})
+}
+
+func findSqliteCleanedOdds(ctx context.Context, q sqlQuerier, where string, args ...any) (odds []CleanedOdds, err error) {
+	err = scanSqliteRows(ctx, q, `SELECT game_id, bookmaker, moneyline_away_price, moneyline_home_price, spread_away_spread, spread_home_spread, spread_away_price, spread_home_price, total, total_over_price, total_under_price FROM cleaned_odds `+where+` ORDER BY game_id`,
+		args, func(rows *sql.Rows) error {
+			var odd CleanedOdds
+			err := rows.Scan(&odd.GameId, &odd.Bookmaker, &odd.MoneyLine.AwayPrice, &odd.MoneyLine.HomePrice,
+				&odd.PointSpread.AwaySpread, &odd.PointSpread.HomeSpread, &odd.PointSpread.AwayPrice, &odd.PointSpread.HomePrice,
+				&odd.Total.Total, &odd.Total.OverPrice, &odd.Total.UnderPrice)
+			odds = append(odds, odd)
+			return err
+		})
+	return odds, err
+}
+
+func (store *sqliteStore) UpsertProcessingErrors(ctx context.Context, failures []ProcessingError) error {
+	return upsertSqliteDocuments(ctx, store, Config.Collections.ProcessingErrors, failures,
+		func(failure ProcessingError) bson.M {
+			return processingErrorFilter(failure.GameId, ProcessType(failure.Process))
+		},
+		func(ctx context.Context, q sqlQuerier, failure ProcessingError) (*ProcessingError, error) {
+			var existing ProcessingError
+			err := q.QueryRowContext(ctx, `SELECT game_id, date, process, reason, recorded_at FROM processing_errors WHERE game_id = ? AND process = ?`, failure.GameId, failure.Process).
+				Scan(&existing.GameId, &existing.Date, &existing.Process, &existing.Reason, &existing.RecordedAt)
+			return scannedDocument(&existing, err)
+		},
+		func(ctx context.Context, q sqlQuerier, failure ProcessingError) error {
+			_, err := q.ExecContext(ctx, `INSERT OR REPLACE INTO processing_errors (game_id, process, date, reason, recorded_at) VALUES (?, ?, ?, ?, ?)`,
+				failure.GameId, failure.Process, failure.Date, failure.Reason, failure.RecordedAt)
+			return err
+		})
+}
+
+func (store *sqliteStore) DeleteProcessingErrors(ctx context.Context, process ProcessType, gameIds []string) error {
+	_, err := store.db.ExecContext(ctx, `DELETE FROM processing_errors WHERE process = ? AND game_id IN (`+sqlPlaceholders(len(gameIds))+`)`,
+		append([]any{string(process)}, sqlArgs(gameIds)...)...)
+	return err
+}
+
+func (store *sqliteStore) UpsertPipelineRun(ctx context.Context, run PipelineRun) error {
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = writeSqlitePipelineRun(ctx, tx, run); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func writeSqlitePipelineRun(ctx context.Context, q sqlQuerier, run PipelineRun) error {
+	key := []any{run.RunId, run.GameDate, run.Stage}
+	if _, err := q.ExecContext(ctx, `DELETE FROM pipeline_runs WHERE run_id = ? AND game_date = ? AND stage = ?`, key...); err != nil {
+		return err
+	}
+	_, err := q.ExecContext(ctx, `INSERT INTO pipeline_runs (run_id, game_date, stage, status, start_time, end_time, games_found, games_cleaned, games_failed, odds_snapshots_fetched, odds_matched, code_version, error) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		append(key, run.Status, run.StartTime, run.EndTime, run.GamesFound, run.GamesCleaned, run.GamesFailed, run.OddsSnapshots, run.OddsMatched, run.CodeVersion, run.Error)...)
+	if err != nil {
+		return err
+	}
+	for _, writes := range run.CollectionWrites {
+		_, err = q.ExecContext(ctx, `INSERT INTO pipeline_run_collection_writes (run_id, game_date, stage, collection, matched, modified, upserted) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			append(key, writes.Collection, writes.Matched, writes.Modified, writes.Upserted)...)
+		if err != nil {
+			return err
+		}
+	}
+	for _, writes := range run.CsvWrites {
+		_, err = q.ExecContext(ctx, `INSERT INTO pipeline_run_csv_writes (run_id, game_date, stage, csv, inserted, updated, deleted) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			append(key, writes.Csv, writes.Inserted, writes.Updated, writes.Deleted)...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/* The status command only reads the stage statuses, so the write counts are not loaded */
+func (store *sqliteStore) FindPipelineRuns(ctx context.Context, dates []string) (runs []PipelineRun, err error) {
+	err = scanSqliteRows(ctx, store.db, `SELECT run_id, game_date, stage, status, start_time, end_time, games_found, games_cleaned, games_failed, odds_snapshots_fetched, odds_matched, code_version, error FROM pipeline_runs WHERE game_date IN (`+sqlPlaceholders(len(dates))+`) ORDER BY end_time`,
+		sqlArgs(dates), func(rows *sql.Rows) error {
+			var run PipelineRun
+			err := rows.Scan(&run.RunId, &run.GameDate, &run.Stage, &run.Status, &run.StartTime, &run.EndTime, &run.GamesFound, &run.GamesCleaned,
+				&run.GamesFailed, &run.OddsSnapshots, &run.OddsMatched, &run.CodeVersion, &run.Error)
+			runs = append(runs, run)
+			return err
+		})
+	return runs, err
+}
+
+/* Times are unix milliseconds. The insert only replaces a lock that is expired or already ours, in a single statement */
+func (store *sqliteStore) AcquireLock(ctx context.Context, lock PipelineLock) error {
+	result, err := store.db.ExecContext(ctx, `INSERT INTO pipeline_locks (lock_id, stage, game_date, run_id, host, pid, acquired_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (lock_id) DO UPDATE SET stage = excluded.stage, game_date = excluded.game_date, run_id = excluded.run_id, host = excluded.host,
+			pid = excluded.pid, acquired_at = excluded.acquired_at, expires_at = excluded.expires_at
+		WHERE pipeline_locks.expires_at <= ? OR (pipeline_locks.run_id = excluded.run_id AND pipeline_locks.host = excluded.host AND pipeline_locks.pid = excluded.pid)`,
+		lock.LockId, lock.Stage, lock.GameDate, lock.RunId, lock.Host, lock.Pid, lock.AcquiredAt.UnixMilli(), lock.ExpiresAt.UnixMilli(), time.Now().UnixMilli())
+	if err != nil {
+		return err
+	}
+	if acquired, err := result.RowsAffected(); err != nil || acquired > 0 {
+		return err
+	}
+
+	var holder PipelineLock
+	var acquiredAt, expiresAt int64
+	err = store.db.QueryRowContext(ctx, `SELECT lock_id, stage, game_date, run_id, host, pid, acquired_at, expires_at FROM pipeline_locks WHERE lock_id = ?`, lock.LockId).
+		Scan(&holder.LockId, &holder.Stage, &holder.GameDate, &holder.RunId, &holder.Host, &holder.Pid, &acquiredAt, &expiresAt)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrLockHeld, lock.LockId)
+	}
+	holder.AcquiredAt, holder.ExpiresAt = time.UnixMilli(acquiredAt).UTC(), time.UnixMilli(expiresAt).UTC()
+	return lockHeldError(holder)
+}
+
+func (store *sqliteStore) RenewLock(ctx context.Context, lock PipelineLock) error {
+	result, err := store.db.ExecContext(ctx, `UPDATE pipeline_locks SET expires_at = ? WHERE lock_id = ? AND run_id = ? AND host = ? AND pid = ?`,
+		lock.ExpiresAt.UnixMilli(), lock.LockId, lock.RunId, lock.Host, lock.Pid)
+	if err != nil {
+		return err
+	}
+	if renewed, err := result.RowsAffected(); err != nil || renewed == 0 {
+		return handleMultipleErrors(err, fmt.Errorf("%w: %s expired and was taken over or removed", ErrLockLost, lock.LockId))
+	}
+	return nil
+}
+
+func (store *sqliteStore) ReleaseLock(ctx context.Context, lock PipelineLock) error {
+	_, err := store.db.ExecContext(ctx, `DELETE FROM pipeline_locks WHERE lock_id = ? AND run_id = ? AND host = ? AND pid = ?`,
+		lock.LockId, lock.RunId, lock.Host, lock.Pid)
+	return err
+}
+
+func (store *sqliteStore) DeleteLock(ctx context.Context, lockId string) error {
+	_, err := store.db.ExecContext(ctx, `DELETE FROM pipeline_locks WHERE lock_id = ?`, lockId)
+	return err
+}
+
+/*
+Writes documents in one transaction, replacing the rows of documents already stored. Writes are
+counted the way a mongo bulk write counts them, and only planned in dry runs
+*/
+func upsertSqliteDocuments[T any](ctx context.Context, store *sqliteStore, collectionName string, docs []T, filter func(T) bson.M,
+	find func(context.Context, sqlQuerier, T) (*T, error), write func(context.Context, sqlQuerier, T) error) error {
+
+	if len(docs) == 0 {
+		loggerFrom(ctx).Info("Found 0 rows to upsert", "collection", collectionName)
+		return nil
+	}
+	if DryRun {
+		var writes = make([]plannedWrite, 0, len(docs))
+		for _, doc := range docs {
+			existingDoc, err := findExistingDocument(ctx, store.db, doc, find)
+			if err != nil {
+				return err
+			}
+			writes = append(writes, plannedWrite{filter: filter(doc), existingDoc: existingDoc, newDoc: doc})
+		}
+		return planUpserts(ctx, collectionName, writes)
+	}
+
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var matched, modified, upserted int64
+	for _, doc := range docs {
+		existingDoc, err := findExistingDocument(ctx, tx, doc, find)
+		if err != nil {
+			return err
+		}
+		if existingDoc == nil {
+			upserted += 1
+		} else {
+			matched += 1
+			newDoc, err := toBsonMap(doc)
+			if err != nil {
+				return err
+			}
+			if len(diffDocuments("", existingDoc, newDoc)) > 0 {
+				modified += 1
+			}
+		}
+		if err = write(ctx, tx, doc); err != nil {
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	recordCollectionWrites(ctx, collectionName, matched, modified, upserted)
+	return nil
+}
+
+func findExistingDocument[T any](ctx context.Context, q sqlQuerier, doc T, find func(context.Context, sqlQuerier, T) (*T, error)) (bson.M, error) {
+	existing, err := find(ctx, q, doc)
+	if err != nil || existing == nil {
+		return nil, err
+	}
+	return toBsonMap(*existing)
+}
+
+func scanSqliteRows(ctx context.Context, q sqlQuerier, query string, args []any, scan func(*sql.Rows) error) error {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err = scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func scannedDocument[T any](doc *T, err error) (*T, error) {
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func sqlPlaceholders(count int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", count), ", ")
+}
+
+func sqlArgs[T any](values []T) []any {
+	var args = make([]any, 0, len(values))
+	for _, value := range values {
+		args = append(args, value)
+	}
+	return args
+}
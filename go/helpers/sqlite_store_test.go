@@ -0,0 +1,122 @@
+package helpers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestSqliteStore(t *testing.T) *sqliteStore {
+	t.Helper()
+	store, err := newSqliteStore(filepath.Join(t.TempDir(), "nba.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close(context.Background()) })
+	return store
+}
+
+func TestSqliteLocks(t *testing.T) {
+	useTestConfig(t)
+	store := newTestSqliteStore(t)
+	ctx := context.Background()
+
+	lock := newPipelineLock("clean_games/2024-10-22", CleanAllGames, "2024-10-22", "run1")
+	other := newPipelineLock("clean_games/2024-10-22", CleanAllGames, "2024-10-22", "run2")
+	if err := store.AcquireLock(ctx, lock); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AcquireLock(ctx, lock); err != nil {
+		t.Errorf("expected the holder to acquire its own lock again, got %v", err)
+	}
+	if err := store.AcquireLock(ctx, other); !errors.Is(err, ErrLockHeld) {
+		t.Errorf("expected another run to find the lock held, got %v", err)
+	}
+
+	lock.ExpiresAt = time.Now().Add(time.Hour)
+	if err := store.RenewLock(ctx, lock); err != nil {
+		t.Errorf("expected the holder to renew the lock, got %v", err)
+	}
+	if err := store.RenewLock(ctx, other); !errors.Is(err, ErrLockLost) {
+		t.Errorf("expected another run not to renew the lock, got %v", err)
+	}
+
+	lock.ExpiresAt = time.Now().Add(-time.Second)
+	if err := store.RenewLock(ctx, lock); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AcquireLock(ctx, other); err != nil {
+		t.Errorf("expected another run to take over the expired lock, got %v", err)
+	}
+	if err := store.RenewLock(ctx, lock); !errors.Is(err, ErrLockLost) {
+		t.Errorf("expected the lock taken over to be lost, got %v", err)
+	}
+
+	if err := store.ReleaseLock(ctx, lock); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AcquireLock(ctx, lock); !errors.Is(err, ErrLockHeld) {
+		t.Errorf("expected releasing a lost lock to leave the new holder's, got %v", err)
+	}
+	if err := store.ReleaseLock(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AcquireLock(ctx, lock); err != nil {
+		t.Errorf("expected a released lock to be free, got %v", err)
+	}
+}
+
+/* Databases created before a column was added get it when opened, except in dry runs, which only read */
+func TestSqliteStoreAddsColumns(t *testing.T) {
+	useTestConfig(t)
+	path := filepath.Join(t.TempDir(), "nba.sqlite")
+	db, err := sql.Open("sqlite3", "file:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`CREATE TABLE cleaned_games (game_id TEXT PRIMARY KEY, date TEXT NOT NULL, start_time TEXT NOT NULL,
+		away_team_id TEXT NOT NULL, home_team_id TEXT NOT NULL, season_id TEXT NOT NULL)`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	DryRun = true
+	_, err = newSqliteStore(path)
+	DryRun = false
+	if err == nil {
+		t.Error("expected a dry run to refuse a database missing columns")
+	}
+
+	store, err := newSqliteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close(context.Background())
+	if missingColumns, err := missingSqliteColumns(store.db); err != nil || len(missingColumns) > 0 {
+		t.Errorf("expected every added column, missing %v, %v", missingColumns, err)
+	}
+}
+
+func TestSqliteDryRunCreatesNothing(t *testing.T) {
+	useTestConfig(t)
+	DryRun = true
+	t.Cleanup(func() { DryRun = false })
+	path := filepath.Join(t.TempDir(), "data", "nba.sqlite")
+	store, err := newSqliteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close(context.Background())
+
+	if count, err := store.CountCleanedGames(context.Background(), "2024-10-22"); err != nil || count != 0 {
+		t.Errorf("expected a missing database to read as empty, got %d, %v", count, err)
+	}
+	if _, err = os.Stat(filepath.Dir(path)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a dry run to create no sqlite file or directory, got %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+/*
+Client for the NBA stats API. The API drops requests missing browser like headers and throttles
+clients sending requests too quickly, so requests are spaced out and throttled requests retried
+*/
+type statsApiClient struct {
+	baseUrl         string
+	httpClient      *http.Client
+	requestInterval time.Duration
+	mu              sync.Mutex
+	nextRequestTime time.Time
+}
+
+type statsApiResponse struct {
+	Resource   string              `json:"resource"`
+	Parameters Parameters          `json:"parameters"`
+	ResultSets []statsApiResultSet `json:"resultSets"`
+}
+
+type statsApiResultSet struct {
+	Name    string          `json:"name"`
+	Headers []string        `json:"headers"`
+	RowSet  [][]interface{} `json:"rowSet"`
+}
+
+var statsApiHeaders = map[string]string{
+	"Accept":             "application/json, text/plain, */*",
+	"Accept-Language":    "en-US,en;q=0.9",
+	"Origin":             "https://www.nba.com",
+	"Referer":            "https://www.nba.com/",
+	"User-Agent":         "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+	"x-nba-stats-origin": "stats",
+	"x-nba-stats-token":  "true",
+}
+
+func newStatsApiClient(cfg StatsApiConfig) *statsApiClient {
+	return &statsApiClient{
+		baseUrl:         cfg.BaseUrl,
+		httpClient:      &http.Client{Timeout: cfg.Timeout},
+		requestInterval: cfg.RequestInterval,
+	}
+}
+
+func (statsClient *statsApiClient) get(ctx context.Context, endpoint string, params url.Values) (*statsApiResponse, error) {
+	for attempt := 0; ; attempt++ {
+		response, retryAfter, err := statsClient.getOnce(ctx, endpoint, params)
+		if err == nil || retryAfter == 0 || attempt >= statsApiRetries {
+			return response, err
+		}
+		loggerFrom(ctx).Warn("Stats API request throttled, retrying", "endpoint", endpoint, "retryAfter", retryAfter.String(), "error", err)
+		if err = sleepContext(ctx, retryAfter); err != nil {
+			return nil, err
+		}
+	}
+}
+
+/* Returns a non zero retry delay when the request was throttled or the API was unavailable */
+func (statsClient *statsApiClient) getOnce(ctx context.Context, endpoint string, params url.Values) (*statsApiResponse, time.Duration, error) {
+	if err := statsClient.waitForTurn(ctx); err != nil {
+		return nil, 0, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, statsClient.baseUrl+"/"+endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	for key, value := range statsApiHeaders {
+		request.Header.Set(key, value)
+	}
+
+	response, err := statsClient.httpClient.Do(request)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500:
+		return nil, retryAfterDelay(response), fmt.Errorf("stats API %s returned status %d", endpoint, response.StatusCode)
+	case response.StatusCode != http.StatusOK:
+		return nil, 0, fmt.Errorf("stats API %s returned status %d", endpoint, response.StatusCode)
+	}
+
+	/* Numbers are kept as json.Number, so integers can be stored as integers */
+	var statsResponse statsApiResponse
+	decoder := json.NewDecoder(io.LimitReader(response.Body, statsApiMaxResponseBytes))
+	decoder.UseNumber()
+	if err = decoder.Decode(&statsResponse); err != nil {
+		return nil, 0, errors.New("error decoding stats API response from " + endpoint + ": " + err.Error())
+	}
+	return &statsResponse, 0, nil
+}
+
+/* Spaces out requests shared across workers by the configured request interval */
+func (statsClient *statsApiClient) waitForTurn(ctx context.Context) error {
+	statsClient.mu.Lock()
+	now := time.Now()
+	requestTime := now
+	if statsClient.nextRequestTime.After(now) {
+		requestTime = statsClient.nextRequestTime
+	}
+	statsClient.nextRequestTime = requestTime.Add(statsClient.requestInterval)
+	statsClient.mu.Unlock()
+
+	return sleepContext(ctx, requestTime.Sub(now))
+}
+
+func retryAfterDelay(response *http.Response) time.Duration {
+	if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return statsApiDefaultRetryDelay
+}
+
+func sleepContext(ctx context.Context, duration time.Duration) error {
+	if duration <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (response *statsApiResponse) resultSet(name string) (*statsApiResultSet, error) {
+	for i := range response.ResultSets {
+		if response.ResultSets[i].Name == name {
+			return &response.ResultSets[i], nil
+		}
+	}
+	return nil, errors.New("stats API response has no result set " + name)
+}
+
+func (resultSet *statsApiResultSet) columnIndex(header string) (int, error) {
+	for i, name := range resultSet.Headers {
+		if name == header {
+			return i, nil
+		}
+	}
+	return 0, errors.New("stats API result set " + resultSet.Name + " has no column " + header)
+}
+
+/*
+Converts rows into the bson values pymongo stored for them, since cleaning games expects the same
+types. Integers become int32 where they fit and int64 otherwise, other numbers become doubles
+*/
+func rowsToBson(rows [][]interface{}) bson.A {
+	bsonRows := make(bson.A, 0, len(rows))
+	for _, row := range rows {
+		bsonRow := make(bson.A, 0, len(row))
+		for _, value := range row {
+			bsonRow = append(bsonRow, jsonValueToBson(value))
+		}
+		bsonRows = append(bsonRows, bsonRow)
+	}
+	return bsonRows
+}
+
+func jsonValueToBson(value interface{}) interface{} {
+	number, ok := value.(json.Number)
+	if !ok {
+		return value
+	}
+	if integer, err := number.Int64(); err == nil {
+		if integer >= math.MinInt32 && integer <= math.MaxInt32 {
+			return int32(integer)
+		}
+		return integer
+	}
+	if float, err := number.Float64(); err == nil {
+		return float
+	}
+	return number.String()
+}
@@ -0,0 +1,180 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const teamGameLogResponse = `{
+	"resource": "teamgamelog",
+	"parameters": {},
+	"resultSets": [{
+		"name": "TeamGameLog",
+		"headers": ["Team_ID", "Game_ID", "GAME_DATE", "MATCHUP", "WL"],
+		"rowSet": [
+			[1610612747, "0022400061", "OCT 22, 2024", "LAL vs. MIN", "W"],
+			[1610612747, "0022400075", "OCT 25, 2024", "LAL vs. PHX", "W"]
+		]
+	}]
+}`
+
+const playByPlayResponse = `{
+	"resource": "playbyplay",
+	"parameters": {"GameID": "0022400061", "StartPeriod": 1, "EndPeriod": 10},
+	"resultSets": [{
+		"name": "PlayByPlay",
+		"headers": ["GAME_ID", "EVENTNUM", "EVENTMSGTYPE", "EVENTMSGACTIONTYPE", "PERIOD", "WCTIMESTRING", "PCTIMESTRING", "HOMEDESCRIPTION", "NEUTRALDESCRIPTION", "VISITORDESCRIPTION", "SCORE", "SCOREMARGIN"],
+		"rowSet": [
+			["0022400061", 2, 12, 0, 1, "7:11 PM", "12:00", null, null, null, null, null],
+			["0022400061", 3000000000, 1, 1, 1, "7:12 PM", "11:41", "James 2' Dunk", null, null, "0 - 2", 2.5]
+		]
+	}]
+}`
+
+/* Serves each request with the next handler, and the last handler once they run out */
+func newStatsApiTestServer(t *testing.T, handlers ...http.HandlerFunc) (*statsApiClient, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-nba-stats-origin") != "stats" || r.Header.Get("User-Agent") == "" {
+			t.Errorf("request to %s is missing the stats API headers", r.URL.Path)
+		}
+		i := int(requests.Add(1)) - 1
+		handlers[min(i, len(handlers)-1)](w, r)
+	}))
+	t.Cleanup(server.Close)
+	return newStatsApiClient(StatsApiConfig{BaseUrl: server.URL, Timeout: 5 * time.Second}), &requests
+}
+
+func respondWith(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}
+}
+
+func respondWithStatus(status int, retryAfter string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(status)
+	}
+}
+
+func TestFetchTeamGameLog(t *testing.T) {
+	statsClient, requests := newStatsApiTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.URL.Path != "/teamgamelog" || query.Get("TeamID") != "1610612747" || query.Get("Season") != "2024-25" ||
+			query.Get("SeasonType") != "Regular Season" || query.Get("DateFrom") != "10/22/2024" || query.Get("DateTo") != "10/22/2024" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		respondWith(teamGameLogResponse)(w, r)
+	})
+
+	entries, err := fetchTeamGameLog(context.Background(), statsClient, 1610612747, "2024-10-22", "2024-25", "Regular Season")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []GameLogEntry{{GameId: "0022400061", Date: "2024-10-22", Matchup: "LAL vs. MIN"}}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("got %+v, want %+v", entries, want)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("got %d requests, want 1", requests.Load())
+	}
+}
+
+func TestFetchRawGameRetriesThrottledRequests(t *testing.T) {
+	statsClient, requests := newStatsApiTestServer(t,
+		respondWithStatus(http.StatusTooManyRequests, "1"),
+		respondWith(playByPlayResponse))
+
+	startTime := time.Now()
+	game := GameLogEntry{GameId: "0022400061", Date: "2024-10-22", Matchup: "LAL vs. MIN"}
+	rawGame, err := fetchRawGame(context.Background(), statsClient, game, "22024")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("got %d requests, want the throttled request and its retry", requests.Load())
+	}
+	if elapsed := time.Since(startTime); elapsed < time.Second {
+		t.Errorf("retried after %s, want the 1s Retry-After delay", elapsed)
+	}
+
+	if rawGame.GameId != "0022400061" || rawGame.SeasonId != "22024" || rawGame.Parameters.EndPeriod != 10 || len(rawGame.PlayByPlayRows) != 2 {
+		t.Errorf("unexpected raw game %+v", rawGame)
+	}
+	row := rawGame.PlayByPlayRows[1].(bson.A)
+	wantTypes := map[int]reflect.Type{
+		0:  reflect.TypeOf(""),
+		1:  reflect.TypeOf(int64(0)),
+		4:  reflect.TypeOf(int32(0)),
+		7:  reflect.TypeOf(""),
+		8:  nil,
+		11: reflect.TypeOf(float64(0)),
+	}
+	for i, want := range wantTypes {
+		if got := reflect.TypeOf(row[i]); got != want {
+			t.Errorf("column %d: got %v of type %v, want type %v", i, row[i], got, want)
+		}
+	}
+}
+
+func TestStatsApiRetriesUnavailableApiUntilRetriesRunOut(t *testing.T) {
+	statsClient, requests := newStatsApiTestServer(t, respondWithStatus(http.StatusServiceUnavailable, "0"))
+	defaultRetryDelay := statsApiDefaultRetryDelay
+	statsApiDefaultRetryDelay = 10 * time.Millisecond
+	t.Cleanup(func() { statsApiDefaultRetryDelay = defaultRetryDelay })
+
+	_, err := statsClient.get(context.Background(), playByPlayEndpoint, nil)
+	if err == nil {
+		t.Fatal("expected an error once the retries run out")
+	}
+	if want := int32(statsApiRetries + 1); requests.Load() != want {
+		t.Errorf("got %d requests, want %d", requests.Load(), want)
+	}
+}
+
+func TestStatsApiDoesNotRetryClientErrors(t *testing.T) {
+	statsClient, requests := newStatsApiTestServer(t, respondWithStatus(http.StatusNotFound, "1"))
+
+	if _, err := statsClient.get(context.Background(), playByPlayEndpoint, nil); err == nil {
+		t.Fatal("expected an error for a 404")
+	}
+	if requests.Load() != 1 {
+		t.Errorf("got %d requests, want 1", requests.Load())
+	}
+}
+
+func TestJsonValueToBson(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  interface{}
+	}{
+		{json.Number("2"), int32(2)},
+		{json.Number("-2147483648"), int32(math.MinInt32)},
+		{json.Number("2147483647"), int32(math.MaxInt32)},
+		{json.Number("2147483648"), int64(math.MaxInt32 + 1)},
+		{json.Number("-2147483649"), int64(math.MinInt32 - 1)},
+		{json.Number("2.5"), 2.5},
+		{json.Number("1e3"), 1000.0},
+		{"0 - 2", "0 - 2"},
+		{nil, nil},
+	}
+	for _, test := range tests {
+		if got := jsonValueToBson(test.value); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got %v (%T), want %v (%T)", test.value, got, got, test.want, test.want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+/*
+Storage of the collections the processes read and write, so processes don't depend on MongoDB.
+Raw and cleaned games and cleaned odds are keyed by game id, raw odds by date and utc hour.
+Upserts replace documents with the same key and only plan the writes in dry runs
+*/
+type Store interface {
+	FindTeamMetadata(ctx context.Context) ([]TeamMetadata, error)
+
+	FindRawGames(ctx context.Context, date string) ([]RawNbaGame, error)
+	FindExistingRawGameIds(ctx context.Context, gameIds []string) ([]string, error)
+	CountRawGames(ctx context.Context, date string) (int64, error)
+	UpsertRawGames(ctx context.Context, games []RawNbaGame) error
+
+	/* Returns nil when no odds were stored for the date and hour */
+	FindRawOdds(ctx context.Context, date string, utcHour int) (*RawOddsResponse, error)
+	CountRawOdds(ctx context.Context, date string, utcHours []int) (int64, error)
+	UpsertRawOdds(ctx context.Context, odds []RawOddsResponse) error
+
+	FindCleanedGames(ctx context.Context, date string) ([]CleanedGame, error)
+	CountCleanedGames(ctx context.Context, date string) (int64, error)
+	UpsertCleanedGames(ctx context.Context, games []CleanedGame) error
+
+	FindCleanedOdds(ctx context.Context, gameIds []string) ([]CleanedOdds, error)
+	UpsertCleanedOdds(ctx context.Context, odds []CleanedOdds) error
+
+	UpsertProcessingErrors(ctx context.Context, failures []ProcessingError) error
+	DeleteProcessingErrors(ctx context.Context, process ProcessType, gameIds []string) error
+
+	UpsertPipelineRun(ctx context.Context, run PipelineRun) error
+	/* Returns the runs of the dates ordered by end time */
+	FindPipelineRuns(ctx context.Context, dates []string) ([]PipelineRun, error)
+
+	/* Takes the lock unless another process holds it unexpired, which returns an error wrapping ErrLockHeld */
+	AcquireLock(ctx context.Context, lock PipelineLock) error
+	/* Extends the expiry of a lock still held by the same process, or returns an error wrapping ErrLockLost */
+	RenewLock(ctx context.Context, lock PipelineLock) error
+	ReleaseLock(ctx context.Context, lock PipelineLock) error
+	/* Removes the lock whoever holds it */
+	DeleteLock(ctx context.Context, lockId string) error
+
+	Close(ctx context.Context) error
+}
+
+func newStore(config NbaConfig) (Store, error) {
+	switch config.Database.Backend {
+	case mongoBackend:
+		return newMongoStore(config)
+	case memoryBackend:
+		return newMemoryStore(config.Database.SeedDirectory)
+	case sqliteBackend:
+		return newSqliteStore(config.Database.SqlitePath)
+	default:
+		return nil, errors.New("found unknown database backend: " + config.Database.Backend)
+	}
+}
+
+/* A write planned in a dry run, existingDoc is nil when the write would insert the document */
+type plannedWrite struct {
+	filter      bson.M
+	existingDoc bson.M
+	newDoc      interface{}
+}
+
+/* Logs and records the outcome of upserting documents into a collection */
+func recordCollectionWrites(ctx context.Context, collectionName string, matched int64, modified int64, upserted int64) {
+	loggerFrom(ctx).Info("Upserted documents", "collection", collectionName,
+		"matched", matched, "modified", modified, "upserted", upserted)
+	stageReportFrom(ctx).recordCollectionWrites(collectionName, matched, modified, upserted)
+	mongoWrites.add(float64(matched), collectionName, "matched")
+	mongoWrites.add(float64(modified), collectionName, "modified")
+	mongoWrites.add(float64(upserted), collectionName, "upserted")
+}
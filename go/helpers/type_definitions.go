@@ -1,18 +1,145 @@
 package helpers
 
-import "go.mongodb.org/mongo-driver/bson"
+import (
+	"sync"
+	"time"
 
-/* Config file */
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+/*
+Config file. Every field can be overridden by an environment variable named after its section and key,
+ex. NBA_ODDSAPI_KEY, see config.go. Secret fields are redacted by config show
+*/
 type NbaConfig struct {
-	Database struct {
-		Schema string `yaml:"schema"`
-		Host   string `yaml:"host"`
-		Port   string `yaml:"port"`
-	} `yaml:"database"`
-	OddsApi struct {
-		BaseUrl string `yaml:"baseUrl"`
-		Key     string `yaml:"key"`
-	} `yaml:"oddsApi"`
+	Database    DatabaseConfig    `yaml:"database"`
+	OddsApi     OddsApiConfig     `yaml:"oddsApi"`
+	StatsApi    StatsApiConfig    `yaml:"statsApi"`
+	Logging     LoggingConfig     `yaml:"logging"`
+	Report      ReportConfig      `yaml:"report"`
+	Metrics     MetricsConfig     `yaml:"metrics"`
+	Scheduler   SchedulerConfig   `yaml:"scheduler"`
+	Odds        OddsConfig        `yaml:"odds"`
+	Csv         CsvConfig         `yaml:"csv"`
+	Collections CollectionsConfig `yaml:"collections"`
+	Sampling    SamplingConfig    `yaml:"sampling"`
+}
+
+/* The MongoDB settings apply on top of uri, which takes the place of host and port when set */
+type DatabaseConfig struct {
+	Backend                string        `yaml:"backend"`
+	Schema                 string        `yaml:"schema"`
+	Uri                    string        `yaml:"uri" secret:"true"`
+	Host                   string        `yaml:"host"`
+	Port                   string        `yaml:"port"`
+	Username               string        `yaml:"username"`
+	Password               string        `yaml:"password" secret:"true"`
+	PasswordFile           string        `yaml:"passwordFile"`
+	AuthSource             string        `yaml:"authSource"`
+	ReplicaSet             string        `yaml:"replicaSet"`
+	Tls                    bool          `yaml:"tls"`
+	TlsCaFile              string        `yaml:"tlsCaFile"`
+	ConnectTimeout         time.Duration `yaml:"connectTimeout"`
+	ServerSelectionTimeout time.Duration `yaml:"serverSelectionTimeout"`
+	OperationTimeout       time.Duration `yaml:"operationTimeout"`
+	SeedDirectory          string        `yaml:"seedDirectory"`
+	SqlitePath             string        `yaml:"sqlitePath"`
+}
+
+type OddsApiConfig struct {
+	BaseUrl string `yaml:"baseUrl"`
+	Key     string `yaml:"key" secret:"true"`
+	/* File holding the key, ex. a docker or kubernetes secret, so it stays out of the config file */
+	KeyFile            string `yaml:"keyFile"`
+	HistoricalOddsPath string `yaml:"historicalOddsPath"`
+}
+
+/* Odds snapshot hours and the bookmakers whose lines are used, most preferred first */
+type OddsConfig struct {
+	Bookmakers       []string `yaml:"bookmakers" json:"bookmakers"`
+	SnapshotUtcHours []int    `yaml:"snapshotUtcHours" json:"snapshotUtcHours"`
+}
+
+type CsvConfig struct {
+	Directory        string `yaml:"directory" json:"directory"`
+	GamesFileName    string `yaml:"gamesFileName" json:"gamesFileName"`
+	PlaysFileName    string `yaml:"playsFileName" json:"playsFileName"`
+	ParquetDirectory string `yaml:"parquetDirectory" json:"parquetDirectory"`
+}
+
+/* MongoDB collection names. The memory store uses them too, and SQLite only in logs and metrics */
+type CollectionsConfig struct {
+	CleanedGames     string `yaml:"cleanedGames" json:"cleanedGames"`
+	CleanedOdds      string `yaml:"cleanedOdds" json:"cleanedOdds"`
+	RawOdds          string `yaml:"rawOdds" json:"rawOdds"`
+	PipelineLocks    string `yaml:"pipelineLocks" json:"pipelineLocks"`
+	PipelineRuns     string `yaml:"pipelineRuns" json:"pipelineRuns"`
+	ProcessingErrors string `yaml:"processingErrors" json:"processingErrors"`
+	RawGames         string `yaml:"rawGames" json:"rawGames"`
+	TeamMetadata     string `yaml:"teamMetadata" json:"teamMetadata"`
+}
+
+/* Play by play granularities, ex. 5s/final3m, see sampling.go */
+type SamplingConfig struct {
+	/* Sampled by games clean besides the 30 second one */
+	Granularities []string `yaml:"granularities" json:"granularities"`
+	/* Emitted by export csv */
+	CsvGranularity string `yaml:"csvGranularity" json:"csvGranularity"`
+}
+
+type ReportConfig struct {
+	Directory string `yaml:"directory"`
+}
+
+type SchedulerConfig struct {
+	Schedule   string        `yaml:"schedule"`
+	StateFile  string        `yaml:"stateFile"`
+	Retries    int           `yaml:"retries"`
+	RetryDelay time.Duration `yaml:"retryDelay"`
+}
+
+type StatsApiConfig struct {
+	BaseUrl         string        `yaml:"baseUrl"`
+	RequestInterval time.Duration `yaml:"requestInterval"`
+	Timeout         time.Duration `yaml:"timeout"`
+}
+
+type MetricsConfig struct {
+	TextfileDirectory string `yaml:"textfileDirectory"`
+	ListenAddress     string `yaml:"listenAddress"`
+}
+
+type LoggingConfig struct {
+	Path       string `yaml:"path"`
+	Level      string `yaml:"level"`
+	Format     string `yaml:"format"`
+	MaxSizeMb  int    `yaml:"maxSizeMb"`
+	MaxBackups int    `yaml:"maxBackups"`
+}
+
+/* Parsed command line options */
+type RunOptions struct {
+	ProcessName string
+	RunId       string
+	Dates       []string
+	Stages      []ProcessType
+	ReportPath  string
+	Schedule    string
+	LagDays     int
+}
+
+/* Persisted state of the scheduler, see scheduler.go */
+type schedulerState struct {
+	LastScheduledTime string        `json:"lastScheduledTime,omitempty"`
+	PendingRun        *scheduledRun `json:"pendingRun,omitempty"`
+}
+
+type scheduledRun struct {
+	ScheduledTime   string   `json:"scheduledTime"`
+	GameDate        string   `json:"gameDate"`
+	CompletedStages []string `json:"completedStages"`
+	Attempts        int      `json:"failedAttempts"`
+	NextAttemptTime string   `json:"nextAttemptTime,omitempty"`
 }
 
 /* Raw game in DB */
@@ -20,15 +147,23 @@ type RawNbaGame struct {
 	Resource       string     `bson:"resource"`
 	Parameters     Parameters `bson:"parameters"`
 	PlayByPlayRows bson.A     `bson:"rawPlayByPlay"`
+	GameId         string     `bson:"gameId"`
 	Date           string     `bson:"date"`
 	Matchup        string     `bson:"matchup"`
 	SeasonId       string     `bson:"seasonId"`
 }
 
 type Parameters struct {
-	GameId     string `bson:"GameID"`
-	StarPeriod int32  `bson:"StartPeriod"`
-	EndPeriod  int32  `bson:"EndPeriod"`
+	GameId     string `bson:"GameID" json:"GameID"`
+	StarPeriod int32  `bson:"StartPeriod" json:"StartPeriod"`
+	EndPeriod  int32  `bson:"EndPeriod" json:"EndPeriod"`
+}
+
+/* Game found in a team game log, before its play by play is fetched */
+type GameLogEntry struct {
+	GameId  string
+	Date    string
+	Matchup string
 }
 
 type RawPlay struct {
@@ -47,12 +182,33 @@ type CleanedGame struct {
 	HomeTeamId string       `bson:"homeTeamId"`
 	PlayByPlay []PlayByPlay `bson:"playByPlay"`
 	SeasonId   string       `bson:"seasonId"`
+	/* Play by play at the configured granularities besides the 30 second one, see sampling.go */
+	Samplings       []Sampling `bson:"samplings,omitempty"`
+	Overtime        bool       `bson:"overtime"`
+	OvertimePeriods int32      `bson:"overtimePeriods"`
 }
 
+type Sampling struct {
+	Granularity string       `bson:"granularity"`
+	PlayByPlay  []PlayByPlay `bson:"playByPlay"`
+}
+
+/* Period counts the overtime periods on from 5, and seconds remaining is what the game clock shows */
 type PlayByPlay struct {
-	SecondsElapsed int32
-	AwayScore      int
-	HomeScore      int
+	SecondsElapsed   int32
+	Period           int32
+	SecondsRemaining int32
+	AwayScore        int
+	HomeScore        int
+}
+
+/* Per game failure recorded in lenient mode */
+type ProcessingError struct {
+	GameId     string `json:"gameId" bson:"gameId"`
+	Date       string `json:"date" bson:"date"`
+	Process    string `json:"process" bson:"process"`
+	Reason     string `json:"reason" bson:"reason"`
+	RecordedAt string `json:"recordedAt" bson:"recordedAt"`
 }
 
 /* Team metadata in DB */
@@ -128,29 +284,141 @@ type PointSpread struct {
 	HomePrice  float32 `bson:"homePrice"`
 }
 
-/* CSV columns */
+/* CSV rows. The csv tags name the columns in order, and the descriptions make up the data dictionary */
 type GameCsv struct {
-	GameId               string
-	SeasonId             string
-	Date                 string
-	StartTime            string
-	AwayTeamAbbreviation string
-	AwayTeamId           string
-	HomeTeamAbbreviation string
-	HomeTeamId           string
-	AwayMl               string
-	HomeMl               string
-	AwaySpread           string
-	HomeSpread           string
-	AwayFinalScore       string
-	HomeFinalScore       string
+	GameId               string  `csv:"game_id" description:"NBA stats API game id, ex. 0022400061"`
+	SeasonId             string  `csv:"season_id" description:"Season type digit followed by the season's starting year, ex. 22024 for the 2024-25 regular season, 52024 for its play-in and 42024 for its playoffs"`
+	Date                 string  `csv:"game_date" format:"date" description:"Game date in Eastern time, formatted 2006-01-02"`
+	StartTime            string  `csv:"start_time" description:"Eastern time of the game's first play as the stats API reports it, ex. 7:40 PM"`
+	AwayTeamAbbreviation string  `csv:"away_team_init" description:"Abbreviation of the away team, ex. BOS"`
+	AwayTeamId           int64   `csv:"away_team_id" description:"NBA stats API team id of the away team"`
+	HomeTeamAbbreviation string  `csv:"home_team_init" description:"Abbreviation of the home team"`
+	HomeTeamId           int64   `csv:"home_team_id" description:"NBA stats API team id of the home team"`
+	AwayMl               float32 `csv:"away_ml" description:"Pregame away moneyline, as a decimal price"`
+	HomeMl               float32 `csv:"home_ml" description:"Pregame home moneyline, as a decimal price"`
+	AwaySpread           float32 `csv:"away_spread" description:"Pregame point spread of the away team, negative when the away team is favored"`
+	HomeSpread           float32 `csv:"home_spread" description:"Pregame point spread of the home team, negative when the home team is favored"`
+	PregameTotal         float32 `csv:"pregame_total" description:"Pregame over under total points line"`
+	AwayFinalScore       int     `csv:"away_final_score" description:"Final score of the away team"`
+	HomeFinalScore       int     `csv:"home_final_score" description:"Final score of the home team"`
+	Overtime             int     `csv:"overtime" description:"1 when the game went to overtime, else 0"`
+	OvertimePeriods      int32   `csv:"overtime_periods" description:"Number of 5 minute overtime periods played, 0 for games decided in regulation"`
 }
 
 type PlayByPlayCsv struct {
-	GameId         string
-	SecondsElapsed string
-	AwayScore      string
-	HomeScore      string
-	UnderdogScore  string
-	FavoriteScore  string
+	GameId           string `csv:"game_id" description:"NBA stats API game id, joining the row to games_summary_data"`
+	SecondsElapsed   int32  `csv:"seconds_elapsed" description:"Game seconds elapsed, a multiple of 30 starting at 0, or of the interval of the granularity the file was exported at. Quarters last 720 seconds and overtime periods 300"`
+	Period           int32  `csv:"period" description:"Period at seconds_elapsed, 1 to 4 for the quarters, and periods 5 and up are overtime. A period's final second belongs to it"`
+	SecondsRemaining int32  `csv:"seconds_remaining" description:"Seconds remaining in the period at seconds_elapsed, as the game clock shows"`
+	AwayScore        int    `csv:"away_score" description:"Away team score at seconds_elapsed"`
+	HomeScore        int    `csv:"home_score" description:"Home team score at seconds_elapsed"`
+	UnderdogScore    int    `csv:"underdog_score" description:"Score of the pregame spread underdog at seconds_elapsed"`
+	FavoriteScore    int    `csv:"favorite_score" description:"Score of the pregame spread favorite at seconds_elapsed, the away team when the spread is a pick'em"`
+	FavoriteMargin   int    `csv:"favorite_margin" description:"favorite_score minus underdog_score, negative when the favorite trails"`
+}
+
+/* Run report, written as json at the end of every process */
+type RunReport struct {
+	RunId     string        `json:"runId"`
+	Process   string        `json:"process"`
+	DryRun    bool          `json:"dryRun"`
+	StartTime string        `json:"startTime"`
+	EndTime   string        `json:"endTime"`
+	Status    string        `json:"status"`
+	GameDates []string      `json:"gameDates"`
+	Settings  RunSettings   `json:"settings"`
+	Dates     []*DateReport `json:"dates"`
+	Errors    []string      `json:"errors"`
+}
+
+/* Effective pipeline settings of a run, so its odds and csvs can be traced back to them */
+type RunSettings struct {
+	Odds               OddsConfig        `json:"odds"`
+	HistoricalOddsPath string            `json:"historicalOddsPath"`
+	Csv                CsvConfig         `json:"csv"`
+	Collections        CollectionsConfig `json:"collections"`
+	Sampling           SamplingConfig    `json:"sampling"`
+	LogPath            string            `json:"logPath"`
+}
+
+type DateReport struct {
+	runId    string
+	GameDate string         `json:"gameDate"`
+	Status   string         `json:"status"`
+	Stages   []*StageReport `json:"stages"`
+	Error    string         `json:"error,omitempty"`
+}
+
+type StageReport struct {
+	mu            sync.Mutex
+	Stage         string                       `json:"stage"`
+	Status        string                       `json:"status"`
+	StartTime     string                       `json:"startTime"`
+	EndTime       string                       `json:"endTime"`
+	GamesFound    int                          `json:"gamesFound"`
+	GamesCleaned  int                          `json:"gamesCleaned"`
+	OddsSnapshots int                          `json:"oddsSnapshotsFetched"`
+	OddsMatched   int                          `json:"oddsMatched"`
+	Bookmakers    map[string]string            `json:"bookmakerByGame,omitempty"`
+	Collections   map[string]*CollectionWrites `json:"collections,omitempty"`
+	Csvs          map[string]*CsvWrites        `json:"csvs,omitempty"`
+	FailedGames   []ProcessingError            `json:"failedGames,omitempty"`
+	Error         string                       `json:"error,omitempty"`
+}
+
+type CollectionWrites struct {
+	Matched  int64 `json:"matched"`
+	Modified int64 `json:"modified"`
+	Upserted int64 `json:"upserted"`
+}
+
+type CsvWrites struct {
+	Inserted int `json:"inserted"`
+	Updated  int `json:"updated"`
+	Deleted  int `json:"deleted"`
+}
+
+/* Pipeline run ledger entry in DB, one per stage run of a date */
+type PipelineRun struct {
+	RunId            string                        `bson:"runId"`
+	GameDate         string                        `bson:"gameDate"`
+	Stage            string                        `bson:"stage"`
+	Status           string                        `bson:"status"`
+	StartTime        string                        `bson:"startTime"`
+	EndTime          string                        `bson:"endTime"`
+	GamesFound       int                           `bson:"gamesFound"`
+	GamesCleaned     int                           `bson:"gamesCleaned"`
+	GamesFailed      int                           `bson:"gamesFailed"`
+	OddsSnapshots    int                           `bson:"oddsSnapshotsFetched"`
+	OddsMatched      int                           `bson:"oddsMatched"`
+	CollectionWrites []PipelineRunCollectionWrites `bson:"collectionWrites"`
+	CsvWrites        []PipelineRunCsvWrites        `bson:"csvWrites"`
+	CodeVersion      string                        `bson:"codeVersion"`
+	Error            string                        `bson:"error,omitempty"`
+}
+
+/* Lease on a stage of a date, or on the csv directory, held by one process at a time until it expires */
+type PipelineLock struct {
+	LockId     string    `bson:"_id" json:"lockId"`
+	Stage      string    `bson:"stage" json:"stage"`
+	GameDate   string    `bson:"gameDate" json:"gameDate"`
+	RunId      string    `bson:"runId" json:"runId"`
+	Host       string    `bson:"host" json:"host"`
+	Pid        int       `bson:"pid" json:"pid"`
+	AcquiredAt time.Time `bson:"acquiredAt" json:"acquiredAt"`
+	ExpiresAt  time.Time `bson:"expiresAt" json:"expiresAt"`
+}
+
+type PipelineRunCollectionWrites struct {
+	Collection string `bson:"collection"`
+	Matched    int64  `bson:"matched"`
+	Modified   int64  `bson:"modified"`
+	Upserted   int64  `bson:"upserted"`
+}
+
+type PipelineRunCsvWrites struct {
+	Csv      string `bson:"csv"`
+	Inserted int    `bson:"inserted"`
+	Updated  int    `bson:"updated"`
+	Deleted  int    `bson:"deleted"`
 }
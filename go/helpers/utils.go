@@ -2,72 +2,128 @@ package helpers
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
-/* MongoDb connection related */
+/* MongoDb connection related. The client is pinged, so a server that is unreachable or rejects the credentials fails at startup */
 func loadMongoDbClient(config NbaConfig) (client *mongo.Client, err error) {
-	clientUrl := "mongodb://" + config.Database.Host + ":" + config.Database.Port
-
-	clientOptions := options.Client().ApplyURI(clientUrl)
+	clientOptions, err := mongoClientOptions(config.Database)
+	if err != nil {
+		return nil, err
+	}
 	client, err = mongo.Connect(context.TODO(), clientOptions)
 	if err != nil {
-		return nil, errors.New("error connecting to mongoDb client")
+		return nil, errors.New("error connecting to mongoDb client: " + err.Error())
+	}
+
+	timeout := config.Database.ConnectTimeout + config.Database.ServerSelectionTimeout
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err = client.Ping(ctx, readpref.Primary()); err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("error reaching MongoDB at %s within %s, check the database hosts, credentials and tls settings: %w",
+			strings.Join(clientOptions.Hosts, ","), timeout, err)
 	}
 	return client, nil
 }
 
-func closeMongoDBConnection(client *mongo.Client, err error) error {
-	if err != nil {
-		return err
+/* The discrete settings are applied over the uri's own options */
+func mongoClientOptions(database DatabaseConfig) (*options.ClientOptions, error) {
+	uri := ternaryOperator(database.Uri != "", database.Uri, "mongodb://"+net.JoinHostPort(database.Host, database.Port))
+	clientOptions := options.Client().ApplyURI(uri).
+		SetConnectTimeout(database.ConnectTimeout).
+		SetServerSelectionTimeout(database.ServerSelectionTimeout)
+	if database.OperationTimeout > 0 {
+		clientOptions.SetTimeout(database.OperationTimeout)
 	}
-	if err = client.Disconnect(context.TODO()); err != nil {
-		return err
+	/* SetAuth replaces the whole credential, so the uri's is kept and only the configured fields are overwritten */
+	if database.Username != "" || (database.AuthSource != "" && clientOptions.Auth != nil) {
+		var credential options.Credential
+		if clientOptions.Auth != nil {
+			credential = *clientOptions.Auth
+		}
+		if database.Username != "" {
+			credential.Username, credential.Password = database.Username, database.Password
+		}
+		if database.AuthSource != "" {
+			credential.AuthSource = database.AuthSource
+		}
+		clientOptions.SetAuth(credential)
 	}
-	return nil
+	if database.ReplicaSet != "" {
+		clientOptions.SetReplicaSet(database.ReplicaSet)
+	}
+	if database.Tls || database.TlsCaFile != "" {
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+		if database.TlsCaFile != "" {
+			caPem, err := os.ReadFile(database.TlsCaFile)
+			if err != nil {
+				return nil, errors.New("error reading database.tlsCaFile: " + err.Error())
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(caPem) {
+				return nil, errors.New("found no PEM certificates in database.tlsCaFile " + database.TlsCaFile)
+			}
+		}
+		clientOptions.SetTLSConfig(tlsConfig)
+	}
+	if err := clientOptions.Validate(); err != nil {
+		return nil, errors.New("invalid MongoDB connection settings: " + err.Error())
+	}
+	return clientOptions, nil
 }
 
 /* DB operations related */
-func upsertItemsGeneric(operations []mongo.WriteModel, dbCollection *mongo.Collection) (writeResult *mongo.BulkWriteResult, err error) {
+func upsertItemsGeneric(ctx context.Context, operations []mongo.WriteModel, dbCollection *mongo.Collection) (writeResult *mongo.BulkWriteResult, err error) {
 	if len(operations) == 0 {
-		Logger.Println("Found 0 rows to upsert")
+		loggerFrom(ctx).Info("Found 0 rows to upsert", "collection", dbCollection.Name())
+	} else if DryRun {
+		return nil, planMongoUpserts(ctx, operations, dbCollection)
 	} else {
-		result, err := dbCollection.BulkWrite(context.TODO(), operations)
+		writeResult, err = dbCollection.BulkWrite(ctx, operations)
 		if err != nil {
 			return nil, err
 		}
-		Logger.Printf("Upserted %v documents", result.UpsertedCount)
+		recordCollectionWrites(ctx, dbCollection.Name(), writeResult.MatchedCount, writeResult.ModifiedCount, writeResult.UpsertedCount)
 	}
 	return writeResult, nil
 }
 
-func findTeamMetadata(teamInfoCollection *mongo.Collection) (teamMetadata []TeamMetadata, err error) {
-	cursor, err1 := teamInfoCollection.Find(context.TODO(), bson.M{})
-	err2 := cursor.All(context.TODO(), &teamMetadata)
-
-	if err1 != nil || err2 != nil {
-		return nil, errors.New("error doing db lookup for team metadata")
-	}
-	return teamMetadata, nil
-}
-
-func findCleanedGame(date string, dbCollection *mongo.Collection) (games []CleanedGame, err error) {
-	cursor, err1 := dbCollection.Find(context.TODO(), dateFieldStringFilter(date))
-	err2 := cursor.All(context.TODO(), &games)
-	if err1 != nil || err2 != nil {
-		return nil, handleMultipleErrors(err1, err2)
+func findCleanedGame(ctx context.Context, date string, store Store) (games []CleanedGame, err error) {
+	games, err = store.FindCleanedGames(ctx, date)
+	if err != nil {
+		return nil, err
 	}
-	Logger.Printf("Found %d processed games in DB", len(games))
+	loggerFrom(ctx).Info("Found processed games in DB", "count", len(games))
 	return games, nil
 }
 
 /* Error management related funcs */
 func ErrorWithFailure(err error) {
-	Logger.Fatalf("Error: %v", err)
+	if Logger == nil {
+		log.Fatalf("Error: %v", err)
+	}
+	Logger.Error("Exiting with failure", "error", err)
+	os.Exit(exitCodeFailure)
+}
+
+func ExitWithPartialSuccess(err error) {
+	Logger.Warn("Exiting with partial success", "error", err)
+	os.Exit(exitCodePartialSuccess)
 }
 
 func handleMultipleErrors(errors ...error) error {
@@ -91,6 +147,14 @@ func dateFieldStringFilter(date string) bson.M {
 	return bson.M{"date": date}
 }
 
+func gameIdFilter(gameId string) bson.M {
+	return bson.M{"gameId": gameId}
+}
+
+func gameIdsFilter(gameIds []string) bson.M {
+	return bson.M{"gameId": bson.M{"$in": gameIds}}
+}
+
 /* Generic util */
 func ternaryOperator[T any](condition bool, val1 T, val2 T) T {
 	if condition {
@@ -99,3 +163,48 @@ func ternaryOperator[T any](condition bool, val1 T, val2 T) T {
 		return val2
 	}
 }
+
+/*
+Writes to a temp file in the same directory, syncs it and renames it over the path, so readers see either
+the old or the new file and a crash never leaves a truncated one. The directory is synced after the rename
+so the rename itself survives a crash
+*/
+func writeFileAtomically(path string, write func(w io.Writer) error) (err error) {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+
+	if err = write(file); err != nil {
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(file.Name(), 0644); err != nil {
+		return err
+	}
+	if err = os.Rename(file.Name(), path); err != nil {
+		return err
+	}
+	return syncDirectory(filepath.Dir(path))
+}
+
+func syncDirectory(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	err1 := dir.Sync()
+	err2 := dir.Close()
+	return handleMultipleErrors(err1, err2)
+}
@@ -0,0 +1,72 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+/*
+Runs fn over every item with at most 'workers' calls in flight. Results keep the order of the items,
+and the first error cancels the context handed to the calls still running
+*/
+func runWorkerPool[T any, R any](ctx context.Context, workers int, items []T, fn func(context.Context, T) (R, error)) ([]R, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var firstErr error
+	var errOnce sync.Once
+	var wg sync.WaitGroup
+	results := make([]R, len(items))
+	indexes := make(chan int)
+
+	for w := 0; w < max(1, min(workers, len(items))); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				result, err := callRecovering(ctx, items[i], fn)
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					continue
+				}
+				results[i] = result
+			}
+		}()
+	}
+
+feed:
+	for i := range items {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+/*
+The recover in RunForDates covers the main goroutine only, so a panic on an item, ex. a game with data it doesn't
+expect, is returned as the item's error, failing it or in lenient mode recording it, instead of crashing the process
+*/
+func callRecovering[T any, R any](ctx context.Context, item T, fn func(context.Context, T) (R, error)) (result R, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx, item)
+}
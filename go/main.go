@@ -1,31 +1,55 @@
 package main
 
 import (
+	"errors"
 	"nba/helpers"
+	"os"
 )
 
 func main() {
-	processName, date, logFile := helpers.Setup()
+	options, logFile := helpers.Setup(os.Args[1:])
 	defer logFile.Close()
 
-	helpers.Logger.Printf("Running process: %s for date: %s", processName, date)
+	helpers.Logger.Info("Running process", "dateCount", len(options.Dates))
 
-	processType, err := helpers.ValueOf(processName)
+	var process helpers.ProcessFunc
+	processType, err := helpers.ValueOf(options.ProcessName)
 	switch processType {
+	case helpers.FetchRawGames:
+		process = helpers.FetchGames
 	case helpers.CleanAllGames:
-		err = helpers.CleanGames(date)
+		process = helpers.CleanGames
 	case helpers.FetchRawOdds:
-		err = helpers.FetchOdds(date)
+		process = helpers.FetchOdds
 	case helpers.CleanRawOdds:
-		err = helpers.CleanOdds(date)
+		process = helpers.CleanOdds
 	case helpers.CombineGameWithOdds:
-		err = helpers.CombineGamesAndOddsToCsv(date)
+		process = helpers.CombineGamesAndOddsToCsv
+	case helpers.RunPipeline:
+		process = helpers.PipelineProcess(options.Stages)
+	case helpers.Serve:
+		err = helpers.RunScheduler(options)
+	case helpers.Status:
+		err = helpers.PrintStatus(options.Dates)
+	case helpers.MigrateToSqlite:
+		err = helpers.RunCommand(helpers.MigrateMongoToSqlite, options)
+	case helpers.ConcatCsvs:
+		err = helpers.RunCommand(func() error { return helpers.ConcatCsvPartitions(options.RunId) }, options)
+	case helpers.WriteDataDictionary:
+		err = helpers.RunCommand(helpers.WriteCsvDataDictionary, options)
+	case helpers.ShowConfig:
+		err = helpers.PrintConfig(os.Stdout)
 	default:
-		helpers.Logger.Println("Incorrect process type parameter")
+		err = errors.New("incorrect process type parameter")
 	}
 
-	if err != nil {
+	if err == nil && process != nil {
+		err = helpers.RunForDates(process, options)
+	}
+	if errors.Is(err, helpers.ErrPartialSuccess) {
+		helpers.ExitWithPartialSuccess(err)
+	} else if err != nil {
 		helpers.ErrorWithFailure(err)
 	}
-	helpers.Logger.Println("No errors detected. Exiting with success")
+	helpers.Logger.Info("No errors detected. Exiting with success")
 }
@@ -2,38 +2,14 @@
 This script is for performing basic analysis on the NBA game data with pregame and in-game odds,
 using the two csvs populated by the game and odds data collection and processing jobs. To configure
 pregame and/or in game filters, fill in the fields in AnalysisConfig.py. Empty filters will be ignored. 
-The hardcoded CSV definitions are below
-
-Game Data CSV Column Indices:
-0: game_id
-1: season_id
-2: game_date
-3: start_time
-4: away_team_init
-5: away_team_id
-6: home_team_init
-7: home_team_id
-8: away_ml
-9: away_spread
-10: home_ml
-11: home_spread
-12: pregame_total
-13: away_final_score
-14: home_final_score
-
-Play By Play CSV Column Indices:
-0: game_id
-1: seconds_elapsed
-2: away_score
-3: home_score
-4: underdog_score
-5: favorite_score
-6: favorite_margin
+The csv columns and their types are read from the data dictionary written by `nba_main export dictionary`,
+see csvs/schema/data_dictionary.md
 """
 
 import analysis_config as cfg
 from enum import Enum
 import csv
+import json
 import numpy as np 
 
 
@@ -41,6 +17,10 @@ import numpy as np
 CSV_DIRECTORY = '/Users/ericwhitehead/Desktop/clag/nba-project-post-mv/csvs'
 GAME_SUMMARY_CSV = 'games_summary_data.csv'
 PLAY_BY_PLAY_CSV = 'game_play_by_play_data.csv'
+SCHEMA_DIRECTORY = f'{CSV_DIRECTORY}/schema'
+
+# JSON Schema types of the data dictionary, to the python types of the values
+SCHEMA_TYPES = {'string': str, 'integer': int, 'number': float}
 
 class AnalysisType(Enum):
     INGAME = 1
@@ -51,14 +31,14 @@ class FilterType(Enum):
     IN_RANGE = 2
 
 class FilterField(Enum):
-    def __init__(self, csvIndex, value, filterType):
-        self._csvIndex = csvIndex
+    def __init__(self, valueGetter, value, filterType):
+        self._valueGetter = valueGetter
         self._filterType = filterType
         self._value = value
         
     @property
-    def csvIndex(self):
-        return self._csvIndex
+    def valueGetter(self):
+        return self._valueGetter
 
     @property 
     def filterType(self):
@@ -69,40 +49,43 @@ class FilterField(Enum):
         return self._value 
     
 
-# Game Summary CSV row lookups 
+# Game Summary CSV row lookups. The away team is the favorite on a pick'em, as in the play by play csv
+def awayIsFavorite(row):
+    return row['away_spread'] <= 0
+
 def getUnderdogId(row):
-    return row[5] if float(row[10]) > 0 else row[7]
+    return row['home_team_id'] if awayIsFavorite(row) else row['away_team_id']
 
 def getFavoriteId(row):
-    return row[5] if float(row[10]) <= 0 else row[7]
+    return row['away_team_id'] if awayIsFavorite(row) else row['home_team_id']
 
 def getFavoriteSpread(row):
-    return abs(float(row[10]))
+    return abs(row['away_spread'])
 
 def getFavoriteMoneyline(row):
-    return float(row[8]) if float(row[10]) <= 0 else float(row[9])
+    return row['away_ml'] if awayIsFavorite(row) else row['home_ml']
 
 # Play by Play CSV row lookups
 def getFavoriteMargin(playsRow):
-    return int(playsRow[5]) - int(playsRow[6])
+    return playsRow['favorite_margin']
 
 def getTotal(playsRow):
-    return int(playsRow[5]) + int(playsRow[6])
+    return playsRow['away_score'] + playsRow['home_score']
 
 
 class GameFilterFields(FilterField):
-    E_AWAY_TEAM_IDS = (lambda row: row[5], cfg.AWAY_TEAM_IDS, FilterType.EQUALITY)
-    E_HOME_TEAM_IDS = (lambda row: row[7], cfg.HOME_TEAM_IDS, FilterType.EQUALITY) 
+    E_AWAY_TEAM_IDS = (lambda row: row['away_team_id'], cfg.AWAY_TEAM_IDS, FilterType.EQUALITY)
+    E_HOME_TEAM_IDS = (lambda row: row['home_team_id'], cfg.HOME_TEAM_IDS, FilterType.EQUALITY) 
     E_UNDERDOG_TEAM_IDS = (getUnderdogId, cfg.UNDERDOG_TEAM_IDS, FilterType.EQUALITY)
     E_FAVORITE_TEAM_IDS = (getFavoriteId, cfg.FAVORITE_TEAM_IDS, FilterType.EQUALITY)
     E_FAVORITE_SPREAD_RANGE = (getFavoriteSpread, cfg.PREGAME_FAVORITE_SPREAD_RANGE, FilterType.IN_RANGE)
     E_FAVORITE_ML_RANGE = (getFavoriteMoneyline, cfg.PREGAME_FAVORITE_ML_RANGE, FilterType.IN_RANGE)
-    E_TOTAL_RANGE = (lambda row: float(row[12]), cfg.PREGAME_TOTAL_RANGE, FilterType.IN_RANGE)
-    E_MONTHS = (lambda row: int(row[2][5:7]), cfg.MONTHS, FilterType.EQUALITY)
-    E_SEASONS = (lambda row: row[1], cfg.SEASONS, FilterType.EQUALITY)
+    E_TOTAL_RANGE = (lambda row: row['pregame_total'], cfg.PREGAME_TOTAL_RANGE, FilterType.IN_RANGE)
+    E_MONTHS = (lambda row: int(row['game_date'][5:7]), cfg.MONTHS, FilterType.EQUALITY)
+    E_SEASONS = (lambda row: row['season_id'], cfg.SEASONS, FilterType.EQUALITY)
 
 class PlayByPlayFilterFields(FilterField): 
-    E_IN_GAME_ELAPSED_SECONDS_RANGE = (lambda row: int(row[1]), cfg.IN_GAME_ELAPSED_SECONDS_RANGE, FilterType.IN_RANGE)
+    E_IN_GAME_ELAPSED_SECONDS_RANGE = (lambda row: row['seconds_elapsed'], cfg.IN_GAME_ELAPSED_SECONDS_RANGE, FilterType.IN_RANGE)
     E_IN_GAME_FAVORITE_MARGIN_RANGE = (getFavoriteMargin, cfg.IN_GAME_FAVORITE_MARGIN_RANGE, FilterType.IN_RANGE)
     E_IN_GAME_TOTAL_RANGE = (getTotal, cfg.IN_GAME_TOTAL_RANGE, FilterType.IN_RANGE)
     
@@ -119,15 +102,26 @@ def checkCriteria(row, valueGetter, filterValues, filterType):
         return val >= lo and val <= hi
         
         
+def loadColumnTypes(csvName):
+    """ Python type of every column, from the csv's JSON Schema in the data dictionary """
+    with open(f'{SCHEMA_DIRECTORY}/{csvName.removesuffix(".csv")}.json', mode='r') as file:
+        schema = json.load(file)
+    return {column: SCHEMA_TYPES[prop['type']] for column, prop in schema['properties'].items()}
+
+
 def loadCsvAndFilter(csvName, filterEnum):
+    """ Rows are dicts keyed by column name, with the values converted to their column's type """
+    columnTypes = loadColumnTypes(csvName)
     filteredRows = []
 
     with open(f'{CSV_DIRECTORY}/{csvName}', mode ='r') as file:
-        rows = csv.reader(file)
-        
-        next(rows)
+        rows = csv.DictReader(file)
+        if rows.fieldnames != list(columnTypes):
+            raise ValueError(f'{csvName} columns {rows.fieldnames} do not match the data dictionary {list(columnTypes)}')
+
         for row in rows:
-            if all(checkCriteria(row, f.csvIndex, f.value, f.filterType) for f in filterEnum):
+            row = {column: columnTypes[column](value) for column, value in row.items()}
+            if all(checkCriteria(row, f.valueGetter, f.value, f.filterType) for f in filterEnum):
                 filteredRows.append(row)
 
     return filteredRows
@@ -158,8 +152,8 @@ def processResults(gameCsvRows):
     favoriteMargins = []
 
     for game in gameCsvRows:
-        favScore = int(game[13]) if float(game[10]) <= 0 else int(game[14])
-        dogScore = int(game[14]) if float(game[10]) < 0 else int(game[13])
+        favScore = game['away_final_score'] if awayIsFavorite(game) else game['home_final_score']
+        dogScore = game['home_final_score'] if awayIsFavorite(game) else game['away_final_score']
         total = favScore + dogScore
         totals.append(total)
         favoriteMargins.append(favScore - dogScore)
@@ -178,7 +172,7 @@ if __name__ == '__main__':
     gameCsvRows = loadCsvAndFilter(GAME_SUMMARY_CSV, GameFilterFields)
 
     if analysisType == AnalysisType.INGAME:
-        playsCsvGameIds = set(map(lambda row: row[0], loadCsvAndFilter(PLAY_BY_PLAY_CSV, PlayByPlayFilterFields))) 
-        gameCsvRows = list(filter(lambda row: row[0] in playsCsvGameIds, gameCsvRows))
+        playsCsvGameIds = set(map(lambda row: row['game_id'], loadCsvAndFilter(PLAY_BY_PLAY_CSV, PlayByPlayFilterFields))) 
+        gameCsvRows = list(filter(lambda row: row['game_id'] in playsCsvGameIds, gameCsvRows))
 
     processResults(gameCsvRows)
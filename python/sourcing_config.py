@@ -1,10 +0,0 @@
-# Config file for go-proj-game-sourcing
-
-class SeasonInfo:
-    PLAYOFF_START_DATE = '2025-04-20'
-    SEASON_YEAR = '2024-25'
-    SEASON_ID = '2024'
-
-class MongoConfig:
-    MONGO_CONNECTION_STRING = 'mongodb://localhost:27017/'
-    MONGO_DB_NAME = 'local-nba-project'